@@ -0,0 +1,121 @@
+package goprotoc
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CacheEntry is a protoc distribution, an installed plugin version or the Incremental manifest of a package
+// in the shared cache dir. Pruning a manifest makes the next Incremental Run regenerate the package.
+type CacheEntry struct {
+	Kind    string // "protoc", "manifest" or the plugin binary name
+	Name    string // protoc download url hash, escaped plugin package path and version, or package
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// CacheDir returns the shared cache dir used by every Generator.
+func CacheDir() string {
+	return rootDir
+}
+
+func ListCache() ([]CacheEntry, error) {
+	kindDirs, err := os.ReadDir(rootDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "os.ReadDir() error")
+	}
+	var entries []CacheEntry
+	for _, kindDir := range kindDirs {
+		if !kindDir.IsDir() {
+			continue
+		}
+		dirEntries, err := os.ReadDir(filepath.Join(rootDir, kindDir.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "os.ReadDir() error")
+		}
+		for _, dirEntry := range dirEntries {
+			// protoc entries are <hash> dirs with <hash>.zip, <hash>.manifest.json and lock files next to them
+			if !dirEntry.IsDir() || strings.Contains(dirEntry.Name(), ".tmp-") {
+				continue
+			}
+			entry := CacheEntry{Kind: kindDir.Name(), Name: dirEntry.Name(), Path: filepath.Join(rootDir, kindDir.Name(), dirEntry.Name())}
+			for _, path := range entry.paths() {
+				if err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+					if err != nil {
+						if os.IsNotExist(err) {
+							return nil
+						}
+						return errors.Wrap(err, "WalkDirFunc error")
+					}
+					info, err := d.Info()
+					if err != nil {
+						return errors.Wrapf(err, "d.Info() error")
+					}
+					if !d.IsDir() {
+						entry.Size += info.Size()
+					}
+					if info.ModTime().After(entry.ModTime) {
+						entry.ModTime = info.ModTime()
+					}
+					return nil
+				}); err != nil {
+					return nil, errors.Wrapf(err, "filepath.WalkDir() error")
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// PruneCache removes cache entries not modified within olderThan, or all entries if olderThan is 0.
+// An entry in use by another process is waited for via the same lock Run takes.
+func (thisP *Generator) PruneCache(ctx context.Context, olderThan time.Duration) ([]CacheEntry, error) {
+	entries, err := ListCache()
+	if err != nil {
+		return nil, errors.Wrapf(err, "ListCache() error")
+	}
+	var pruned []CacheEntry
+	for _, entry := range entries {
+		if olderThan > 0 && time.Since(entry.ModTime) < olderThan {
+			continue
+		}
+		lockPath := entry.Path
+		if entry.Kind == filepath.Base(protocDistDir) {
+			lockPath += ".zip"
+		}
+		unlock, err := thisP.lockCacheEntry(ctx, lockPath)
+		if err != nil {
+			return pruned, errors.Wrapf(err, "lockCacheEntry() error")
+		}
+		for _, path := range entry.paths() {
+			if err = os.RemoveAll(path); err != nil {
+				unlock()
+				return pruned, errors.Wrapf(err, "os.RemoveAll() error")
+			}
+		}
+		unlock()
+		thisP.Logger.Infof("cache entry pruned: [%s]", entry.Path)
+		pruned = append(pruned, entry)
+	}
+	return pruned, nil
+}
+
+func (thisV CacheEntry) paths() []string {
+	return []string{thisV.Path, thisV.Path + ".zip", getProtocDistManifestPath(thisV.Path)}
+}
@@ -0,0 +1,31 @@
+package goprotoc
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/sky91/go-protoc/internal"
+	"time"
+)
+
+// lockCacheEntry serializes processes sharing a cache entry under rootDir.
+func (thisP *Generator) lockCacheEntry(ctx context.Context, entryPath string) (unlock func(), err error) {
+	lockPath := entryPath + ".lock"
+	unlockFile, err := internal.LockFile(ctx, lockPath, thisP.getLockTimeout(), func() {
+		thisP.Logger.Infof("waiting for lock held by another process: [%s], timeout=[%s]", lockPath, thisP.getLockTimeout())
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "LockFile() error")
+	}
+	return func() {
+		if err := unlockFile(); err != nil {
+			thisP.Logger.Errorf("unlock error: [%s], err=[%+v]", lockPath, err)
+		}
+	}, nil
+}
+
+func (thisP *Generator) getLockTimeout() time.Duration {
+	if thisP.LockTimeout > 0 {
+		return thisP.LockTimeout
+	}
+	return defaultLockTimeout
+}
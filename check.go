@@ -0,0 +1,156 @@
+package goprotoc
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sky91/go-protoc/internal"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// OutOfDateError is returned by Run in Check mode when the committed generated code differs from a fresh generation.
+// Paths are slash separated and relative to the module dir.
+type OutOfDateError struct {
+	Added   []string
+	Removed []string
+	Changed []string
+	Diffs   map[string]string // changed path -> unified diff
+}
+
+func (thisP *OutOfDateError) Error() string {
+	buf := strings.Builder{}
+	buf.WriteString("generated code is out of date, run go generate:")
+	for _, path := range thisP.Added {
+		_, _ = fmt.Fprintf(&buf, "\n\tadded: %s", path)
+	}
+	for _, path := range thisP.Removed {
+		_, _ = fmt.Fprintf(&buf, "\n\tremoved: %s", path)
+	}
+	for _, path := range thisP.Changed {
+		_, _ = fmt.Fprintf(&buf, "\n\tchanged: %s", path)
+	}
+	for _, path := range thisP.Changed {
+		_, _ = fmt.Fprintf(&buf, "\n%s", strings.TrimSuffix(thisP.Diffs[path], "\n"))
+	}
+	return buf.String()
+}
+
+func (thisP *OutOfDateError) empty() bool {
+	return len(thisP.Added)+len(thisP.Removed)+len(thisP.Changed) == 0
+}
+
+// merge adds the paths of other, prefixed with prefix.
+func (thisP *OutOfDateError) merge(other *OutOfDateError, prefix string) {
+	for _, path := range other.Added {
+		thisP.Added = append(thisP.Added, prefix+path)
+	}
+	for _, path := range other.Removed {
+		thisP.Removed = append(thisP.Removed, prefix+path)
+	}
+	for _, path := range other.Changed {
+		thisP.Changed = append(thisP.Changed, prefix+path)
+		thisP.Diffs[prefix+path] = other.Diffs[path]
+	}
+}
+
+// listCommitted lists the committed files a generation replaces, as slash paths relative to moduleDir:
+// every file of the clean dirs, or with SafeClean the clean paths.
+func (thisP *Generator) listCommitted(moduleDir string, cleanDirs, cleanPaths []string) ([]string, error) {
+	if !thisP.SafeClean {
+		cleanPaths = cleanDirs
+	}
+	var committed []string
+	for _, path := range cleanPaths {
+		files, err := listFilesRel(moduleDir, path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "listFilesRel() error")
+		}
+		committed = append(committed, files...)
+	}
+	return committed, nil
+}
+
+// moveDirsToModule returns dirs under fromModuleDir at the same place under toModuleDir.
+func moveDirsToModule(fromModuleDir, toModuleDir string, dirs []string) ([]string, error) {
+	moved := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(fromModuleDir, dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "filepath.Rel() error")
+		}
+		moved = append(moved, filepath.Join(toModuleDir, rel))
+	}
+	return moved, nil
+}
+
+// compareGenerated compares a generation into outDir with the committed files in moduleDir.
+func compareGenerated(moduleDir, outDir string, committedFiles []string) error {
+	generated, err := listFilesRel(outDir, outDir)
+	if err != nil {
+		return errors.Wrapf(err, "listFilesRel() error")
+	}
+	committed := map[string]bool{}
+	for _, file := range committedFiles {
+		committed[file] = true
+	}
+
+	outOfDate := &OutOfDateError{Diffs: map[string]string{}}
+	for _, file := range generated {
+		delete(committed, file)
+		newBytes, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(file)))
+		if err != nil {
+			return errors.Wrapf(err, "os.ReadFile() error")
+		}
+		oldBytes, err := os.ReadFile(filepath.Join(moduleDir, filepath.FromSlash(file)))
+		if os.IsNotExist(err) {
+			outOfDate.Added = append(outOfDate.Added, file)
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "os.ReadFile() error")
+		}
+		if !bytes.Equal(oldBytes, newBytes) {
+			outOfDate.Changed = append(outOfDate.Changed, file)
+			outOfDate.Diffs[file] = internal.UnifiedDiff("a/"+file, "b/"+file, string(oldBytes), string(newBytes))
+		}
+	}
+	for file := range committed {
+		outOfDate.Removed = append(outOfDate.Removed, file)
+	}
+	sort.Strings(outOfDate.Removed)
+
+	if !outOfDate.empty() {
+		return outOfDate
+	}
+	return nil
+}
+
+// listFilesRel lists regular files under dir, as slash paths relative to base; a missing dir has no files.
+func listFilesRel(base, dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return nil
+			}
+			return errors.Wrap(err, "WalkDirFunc error")
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return errors.Wrapf(err, "filepath.Rel() error")
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
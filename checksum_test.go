@@ -0,0 +1,49 @@
+package goprotoc
+
+import (
+	"encoding/hex"
+	"sort"
+	"testing"
+)
+
+// protocOsArches returns every OsArch getProtocOsArch can return.
+func protocOsArches(t *testing.T) []string {
+	osArchSet := map[string]bool{}
+	for _, goos := range []string{"darwin", "linux", "windows"} {
+		for _, goarch := range []string{"386", "amd64", "arm", "arm64"} {
+			t.Setenv("GOOS", goos)
+			t.Setenv("GOARCH", goarch)
+			if osArch, err := getProtocOsArch(); err == nil {
+				osArchSet[osArch] = true
+			}
+		}
+	}
+	osArches := make([]string, 0, len(osArchSet))
+	for osArch := range osArchSet {
+		osArches = append(osArches, osArch)
+	}
+	sort.Strings(osArches)
+	return osArches
+}
+
+func TestKnownProtocSHA256(t *testing.T) {
+	osArches := protocOsArches(t)
+	if len(osArches) != 8 {
+		t.Fatalf("protocOsArches() = %v, want 8", osArches)
+	}
+	for version, checksums := range knownProtocSHA256 {
+		for _, osArch := range osArches {
+			checksum, ok := checksums[osArch]
+			if !ok {
+				t.Errorf("no sha256 pinned: version=[%s], osArch=[%s]", version, osArch)
+				continue
+			}
+			if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != 32 {
+				t.Errorf("malformed sha256: version=[%s], osArch=[%s], sha256=[%s]", version, osArch, checksum)
+			}
+		}
+		if len(checksums) != len(osArches) {
+			t.Errorf("unknown OsArch pinned: version=[%s], pinned=%d, osArches=%v", version, len(checksums), osArches)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package goprotoc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sky91/go-protoc/internal"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// generatedHeaderRegexp is the header go generators put before the package clause, see https://go.dev/s/generatedcode.
+var generatedHeaderRegexp = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// PlanClean returns the files and dirs Clean would remove, without removing anything.
+func (thisP *Generator) PlanClean(ctx context.Context) ([]string, error) {
+	genFilePkg, genPkg, err := thisP.resolvePackages()
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolvePackages() error")
+	}
+	cleanPaths, err := thisP.planClean(genFilePkg, genPkg, readGenerationManifest(thisP.getGenerationManifestPath(genPkg)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "planClean() error")
+	}
+	return cleanPaths, nil
+}
+
+// planClean returns the paths to remove before generation: the CleanDir dirs,
+// or with SafeClean the files in them that are generated or listed in the outputs of prevManifest.
+func (thisP *Generator) planClean(genFilePkg, genPkg *internal.PackagePublic, prevManifest *generationManifest) ([]string, error) {
+	cleanDirs := thisP.getCleanDirsAbs(genFilePkg.Dir)
+	if err := checkCleanDirs(getModuleDir(genPkg), cleanDirs); err != nil {
+		return nil, err
+	}
+	return thisP.planCleanDirs(cleanDirs, prevManifest)
+}
+
+// planCleanDirs lists the paths of cleanDirs to remove: the dirs themselves, or with SafeClean their generated files.
+func (thisP *Generator) planCleanDirs(cleanDirs []string, prevManifest *generationManifest) ([]string, error) {
+	var cleanPaths []string
+	for _, dir := range cleanDirs {
+		if !thisP.SafeClean {
+			if _, err := os.Stat(dir); err == nil {
+				cleanPaths = append(cleanPaths, dir)
+			}
+			continue
+		}
+		files, err := listFilesRel(dir, dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "listFilesRel() error")
+		}
+		for _, file := range files {
+			path := filepath.Join(dir, filepath.FromSlash(file))
+			if _, ok := prevManifest.output(path); ok {
+				cleanPaths = append(cleanPaths, path)
+				continue
+			}
+			if generated, err := hasGeneratedHeader(path); err != nil {
+				return nil, errors.Wrapf(err, "hasGeneratedHeader() error")
+			} else if generated {
+				cleanPaths = append(cleanPaths, path)
+				continue
+			}
+			thisP.Logger.Infof("keep file not generated: [%s]", path)
+		}
+	}
+	return cleanPaths, nil
+}
+
+// removeCleanPaths removes the paths planned by planClean, then the dirs SafeClean left empty.
+func (thisP *Generator) removeCleanPaths(cleanDirs, cleanPaths []string) error {
+	for _, path := range cleanPaths {
+		thisP.Logger.Infof("clean: [%s]", path)
+		if err := os.RemoveAll(path); err != nil {
+			return errors.Wrapf(err, "os.RemoveAll() error")
+		}
+	}
+	if !thisP.SafeClean {
+		return nil
+	}
+	for _, cleanDir := range cleanDirs {
+		if err := removeEmptyDirs(cleanDir); err != nil {
+			return errors.Wrapf(err, "removeEmptyDirs() error")
+		}
+	}
+	return nil
+}
+
+// checkCleanDirs refuses clean dirs that are the module dir or outside of it.
+func checkCleanDirs(moduleDir string, cleanDirs []string) error {
+	for _, dir := range cleanDirs {
+		rel, err := filepath.Rel(moduleDir, dir)
+		if err != nil {
+			return errors.Wrapf(err, "filepath.Rel() error")
+		}
+		if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("refuse to clean dir not inside the module dir: [%s], module dir=[%s]", dir, moduleDir)
+		}
+	}
+	return nil
+}
+
+// hasGeneratedHeader reports whether a "Code generated ... DO NOT EDIT." line comes before the package clause of the file.
+func hasGeneratedHeader(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, errors.Wrapf(err, "os.Open() error")
+	}
+	defer func() { _ = file.Close() }()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if generatedHeaderRegexp.MatchString(line) {
+			return true, nil
+		}
+		if strings.HasPrefix(line, "package ") {
+			return false, nil
+		}
+	}
+	if err = scanner.Err(); err != nil && err != bufio.ErrTooLong {
+		return false, errors.Wrapf(err, "scanner.Err() error")
+	}
+	return false, nil
+}
+
+// removeEmptyDirs removes dir and the dirs under it that contain no file, deepest first.
+func removeEmptyDirs(dir string) error {
+	var dirs []string
+	if err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return nil
+			}
+			return errors.Wrap(err, "WalkDirFunc error")
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "filepath.WalkDir() error")
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, path := range dirs {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return errors.Wrapf(err, "os.ReadDir() error")
+		}
+		if len(entries) > 0 {
+			continue
+		}
+		if err = os.Remove(path); err != nil {
+			return errors.Wrapf(err, "os.Remove() error")
+		}
+	}
+	return nil
+}
+
+func getModuleDir(pkg *internal.PackagePublic) string {
+	if pkg.Module != nil && pkg.Module.Dir != "" {
+		return pkg.Module.Dir
+	}
+	return pkg.Dir
+}
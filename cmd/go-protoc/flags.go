@@ -0,0 +1,365 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	goprotoc "github.com/sky91/go-protoc"
+	"github.com/sky91/go-protoc/internal"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// options are the flags of a command that are not Generator fields.
+type options struct {
+	noConfig bool
+	dryRun   bool
+	all      bool
+}
+
+// parseGeneratorFlags builds a Generator from the config files of the target package and flags, flags take precedence.
+// The package is given as the only argument. Args are parsed once, then the flags set are applied on top of the config in order.
+func parseGeneratorFlags(command string, args []string) (*goprotoc.Generator, *options, error) {
+	target := &goprotoc.Generator{}
+	flagSet, opts := newGeneratorFlagSet(command, target)
+	var setFlags []setFlag
+	flagSet.VisitAll(func(f *flag.Flag) {
+		f.Value = &recordingValue{Value: f.Value, name: f.Name, setFlags: &setFlags}
+	})
+	if err := flagSet.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	switch flagSet.NArg() {
+	case 0:
+		if target.TargetDir == "" && target.TargetPackage == "" && os.Getenv("GOFILE") == "" && os.Getenv("GOPACKAGE") == "" {
+			target.TargetDir = "."
+		}
+	case 1:
+		target.TargetDir, target.TargetPackage = "", flagSet.Arg(0)
+	default:
+		flagSet.Usage()
+		return nil, nil, fmt.Errorf("too many arguments: %v", flagSet.Args())
+	}
+	if opts.noConfig {
+		if err := target.Init(); err != nil {
+			return nil, nil, err
+		}
+		return target, opts, nil
+	}
+
+	configDir, err := getConfigDir(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	generator, err := goprotoc.LoadConfig(configDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	configFlagSet, _ := newGeneratorFlagSet(command, generator)
+	for _, f := range setFlags {
+		if err = configFlagSet.Set(f.name, f.value); err != nil {
+			return nil, nil, fmt.Errorf("invalid value [%s] for flag -%s: %w", f.value, f.name, err)
+		}
+	}
+	generator.TargetDir, generator.TargetPackage = target.TargetDir, target.TargetPackage
+	if err = generator.Init(); err != nil {
+		return nil, nil, err
+	}
+	return generator, opts, nil
+}
+
+// setFlag is a flag set on the command line.
+type setFlag struct {
+	name  string
+	value string
+}
+
+// recordingValue records every value set, so the flags set can be applied to another Generator.
+type recordingValue struct {
+	flag.Value
+	name     string
+	setFlags *[]setFlag
+}
+
+func (thisP *recordingValue) Set(value string) error {
+	if err := thisP.Value.Set(value); err != nil {
+		return err
+	}
+	*thisP.setFlags = append(*thisP.setFlags, setFlag{name: thisP.name, value: value})
+	return nil
+}
+
+func (thisP *recordingValue) IsBoolFlag() bool {
+	boolFlag, ok := thisP.Value.(interface{ IsBoolFlag() bool })
+	return ok && boolFlag.IsBoolFlag()
+}
+
+// getConfigDir returns the dir LoadConfig starts from for the target package.
+func getConfigDir(target *goprotoc.Generator) (string, error) {
+	if target.TargetPackage == "" {
+		return target.TargetDir, nil
+	}
+	pkgs, cmd, err := internal.GoListPkgs(target.TargetPackage, nil)
+	if err != nil {
+		return "", fmt.Errorf("GoListPkgs() error: cmd=[%+v], err=[%w]", cmd, err)
+	}
+	if len(pkgs) != 1 || pkgs[0].Dir == "" {
+		return "", fmt.Errorf("package must match exactly one dir: [%s], cmd=[%+v]", target.TargetPackage, cmd)
+	}
+	return pkgs[0].Dir, nil
+}
+
+// newGeneratorFlagSet binds a flag for every Generator field, defaulting to the current values.
+func newGeneratorFlagSet(command string, generator *goprotoc.Generator) (flagSet *flag.FlagSet, opts *options) {
+	flagSet = flag.NewFlagSet(command, flag.ExitOnError)
+	flagSet.Usage = func() {
+		_, _ = fmt.Fprintf(flagSet.Output(), "usage: go-protoc %s [flags] [package]\n", command)
+		// the flags of flagSet may be wrapped by recordingValue, which hides their types and defaults
+		usageFlagSet, _ := newGeneratorFlagSet(command, &goprotoc.Generator{})
+		usageFlagSet.SetOutput(flagSet.Output())
+		usageFlagSet.PrintDefaults()
+	}
+	opts = &options{}
+	flagSet.BoolVar(&opts.noConfig, "no-config", false, "ignore the go-protoc.json/yaml config files from the module root to the package dir")
+	if command == "clean" {
+		flagSet.BoolVar(&opts.dryRun, "dry-run", false, "print the files and dirs clean would remove, without removing them")
+	}
+	if command == "generate" || command == "check" {
+		flagSet.BoolVar(&opts.all, "all", false, "generate every package with a proto dir in the module or go.work workspace")
+	}
+	flagSet.StringVar(&generator.ProtoDir, "proto-dir", generator.ProtoDir, "dir of the .proto files, relative to the package dir (default \"proto\")")
+	flagSet.StringVar(&generator.TargetDir, "target-dir", generator.TargetDir, "dir of the package to generate for (default: the go:generate file or the current dir)")
+	flagSet.StringVar(&generator.TargetPackage, "target-package", generator.TargetPackage, "import path of the package to generate for, same as the package argument")
+	flagSet.StringVar(&generator.CleanDir, "clean-dir", generator.CleanDir, "comma separated dirs removed before generation, relative to the package dir (default \"proto_gen_go\")")
+	flagSet.BoolVar(&generator.SafeClean, "safe-clean", generator.SafeClean, "only remove the files of the clean dirs that are generated or were output by the last run")
+	flagSet.StringVar(&generator.ProtocDownloadUrl, "protoc-download-url", generator.ProtocDownloadUrl, "protoc zip url template with {{.Version}} and {{.OsArch}}")
+	flagSet.StringVar(&generator.ProtocVer, "protoc-ver", generator.ProtocVer, "protoc version")
+	flagSet.Var((*mapFlag)(&generator.ProtocSHA256), "protoc-sha256", "pinned protoc zip sha256 as <OsArch>=<hex>, repeatable")
+	flagSet.BoolVar(&generator.AllowUnpinned, "allow-unpinned-protoc", generator.AllowUnpinned, "run a protoc zip with no pinned sha256 instead of failing")
+	flagSet.StringVar(&generator.ProtocLocalPath, "protoc-local-path", generator.ProtocLocalPath, "protoc zip or extracted dir used in offline mode")
+	flagSet.BoolVar(&generator.Offline, "offline", generator.Offline, "never access the network")
+	flagSet.DurationVar(&generator.LockTimeout, "lock-timeout", generator.LockTimeout, "max wait for another process holding a cache entry lock")
+	flagSet.StringVar(&generator.ProtocGenGoGrpcVer, "protoc-gen-go-grpc-ver", generator.ProtocGenGoGrpcVer, "protoc-gen-go-grpc version")
+	flagSet.Var((*stringsFlag)(&generator.CustomProtocOpts), "protoc-opt", "extra protoc option, repeatable; relative --<name>_out dirs are relative to the package dir")
+	flagSet.Var((*stringsFlag)(&generator.ExtraProtoPaths), "proto-path", "extra proto path relative to the package dir, repeatable")
+	flagSet.Var((*mapFlag)(&generator.ExtraOutputs), "extra-output", "extra protoc output as <name>=<dir relative to the module dir>, repeatable")
+	flagSet.Var((*multiMapFlag)(&generator.PluginParams), "plugin-param", "extra plugin param as <plugin name>:<param>, repeatable")
+	flagSet.Var((*pathsModeFlag)(&generator.GoOptions.Paths), "go-paths", "paths option of the go and go-grpc plugins: module, import or source_relative (default module)")
+	flagSet.StringVar(&generator.GoOptions.OutDir, "go-out-dir", generator.GoOptions.OutDir, "out dir of the go and go-grpc plugins, relative to the module dir")
+	flagSet.Var((*mapFlag)(&generator.GoOptions.Mappings), "go-mapping", "Go import path of a .proto file as <file>=<import path>, rendered as M<file>=<import path>, repeatable")
+	flagSet.StringVar(&generator.GoOptions.DefaultAPILevel, "go-default-api-level", generator.GoOptions.DefaultAPILevel, "default_api_level of the go plugin: API_OPEN, API_HYBRID or API_OPAQUE")
+	flagSet.Var(&optionalBoolFlag{target: &generator.GoOptions.GrpcRequireUnimplementedServers}, "go-grpc-require-unimplemented-servers", "require_unimplemented_servers of the go-grpc plugin (default: the plugin default)")
+	flagSet.Var(&optionalBoolFlag{target: &generator.GoOptions.GrpcUseGenericStreams}, "go-grpc-use-generic-streams", "use_generic_streams_experimental of the go-grpc plugin (default: the plugin default)")
+	flagSet.Var((*pluginsFlag)(&generator.Plugins), "plugin",
+		"extra plugin as comma separated pkg=,version=,name=,out=,opt=,enable-if-pkg=,disabled; opt is repeatable, plugin is repeatable")
+	flagSet.StringVar(&generator.DescriptorSet.Out, "descriptor-set-out", generator.DescriptorSet.Out, "also write a FileDescriptorSet to this file, relative to the package dir")
+	flagSet.BoolVar(&generator.DescriptorSet.IncludeImports, "descriptor-set-include-imports", generator.DescriptorSet.IncludeImports, "include the imported files in the descriptor set")
+	flagSet.BoolVar(&generator.DescriptorSet.IncludeSourceInfo, "descriptor-set-include-source-info", generator.DescriptorSet.IncludeSourceInfo, "include comments and positions in the descriptor set")
+	flagSet.StringVar(&generator.DescriptorSet.GoFile, "descriptor-set-go-file", generator.DescriptorSet.GoFile, "Go file embedding the descriptor set, relative to the package dir")
+	flagSet.StringVar(&generator.DescriptorSet.GoPackageName, "descriptor-set-go-package", generator.DescriptorSet.GoPackageName, "package name of the descriptor set Go file (default: the name of its dir)")
+	flagSet.BoolVar(&generator.DisableJetBrains, "disable-jetbrains", generator.DisableJetBrains, "do not configure the JetBrains ProtoEditor plugin, even if listed in -ide")
+	flagSet.Var((*ideIntegrationsFlag)(&generator.IDEIntegrations), "ide",
+		fmt.Sprintf("comma separated IDE integrations of %v, empty for none (default jetbrains)", goprotoc.IDEIntegrationNames()))
+	flagSet.Var((*backendFlag)(&generator.Backend), "backend", "protoc or go (default \"protoc\")")
+	flagSet.BoolVar(&generator.Check, "check", generator.Check, "fail if the generated code is out of date instead of writing it")
+	flagSet.BoolVar(&generator.Incremental, "incremental", generator.Incremental, "skip generation when nothing changed since the last run")
+	flagSet.Var((*diagnosticFormatFlag)(&generator.DiagnosticFormat), "diagnostic-format", "raw, vet or github (default raw)")
+	flagSet.IntVar(&generator.Parallelism, "parallelism", generator.Parallelism, "max packages generated at once with -all (default GOMAXPROCS)")
+	return flagSet, opts
+}
+
+type stringsFlag []string
+
+func (thisP *stringsFlag) String() string {
+	return strings.Join(*thisP, " ")
+}
+
+func (thisP *stringsFlag) Set(value string) error {
+	*thisP = append(*thisP, value)
+	return nil
+}
+
+type mapFlag map[string]string
+
+func (thisP *mapFlag) String() string {
+	pairs := make([]string, 0, len(*thisP))
+	for key, value := range *thisP {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (thisP *mapFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expect <key>=<value>: [%s]", value)
+	}
+	if *thisP == nil {
+		*thisP = map[string]string{}
+	}
+	(*thisP)[key] = val
+	return nil
+}
+
+type multiMapFlag map[string][]string
+
+func (thisP *multiMapFlag) String() string {
+	var pairs []string
+	for key, values := range *thisP {
+		for _, value := range values {
+			pairs = append(pairs, key+":"+value)
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (thisP *multiMapFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, ":")
+	if !ok {
+		return fmt.Errorf("expect <key>:<value>: [%s]", value)
+	}
+	if *thisP == nil {
+		*thisP = map[string][]string{}
+	}
+	(*thisP)[key] = append((*thisP)[key], val)
+	return nil
+}
+
+type pluginsFlag []goprotoc.Plugin
+
+func (thisP *pluginsFlag) String() string {
+	pkgs := make([]string, 0, len(*thisP))
+	for _, plugin := range *thisP {
+		pkgs = append(pkgs, plugin.Pkg)
+	}
+	return strings.Join(pkgs, " ")
+}
+
+func (thisP *pluginsFlag) Set(value string) error {
+	plugin := goprotoc.Plugin{}
+	for _, field := range strings.Split(value, ",") {
+		key, val, _ := strings.Cut(field, "=")
+		switch key {
+		case "pkg":
+			plugin.Pkg = val
+		case "version":
+			plugin.Version = val
+		case "name":
+			plugin.Name = val
+		case "out":
+			plugin.OutDir = val
+		case "opt":
+			plugin.Opts = append(plugin.Opts, val)
+		case "enable-if-pkg":
+			plugin.EnableIfPkg = val
+		case "disabled":
+			plugin.Disabled = true
+		default:
+			return fmt.Errorf("unknown plugin field: [%s]", key)
+		}
+	}
+	if plugin.Pkg == "" && !plugin.Disabled {
+		return fmt.Errorf("plugin pkg is required: [%s]", value)
+	}
+	*thisP = append(*thisP, plugin)
+	return nil
+}
+
+type ideIntegrationsFlag []goprotoc.IDEIntegration
+
+func (thisP *ideIntegrationsFlag) String() string {
+	names := make([]string, 0, len(*thisP))
+	for _, integration := range *thisP {
+		names = append(names, integration.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func (thisP *ideIntegrationsFlag) Set(value string) error {
+	integrations := []goprotoc.IDEIntegration{}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		integration, err := goprotoc.IDEIntegrationByName(name)
+		if err != nil {
+			return err
+		}
+		integrations = append(integrations, integration)
+	}
+	*thisP = integrations
+	return nil
+}
+
+type pathsModeFlag goprotoc.PathsMode
+
+func (thisP *pathsModeFlag) String() string {
+	return string(*thisP)
+}
+
+func (thisP *pathsModeFlag) Set(value string) error {
+	switch paths := goprotoc.PathsMode(value); paths {
+	case goprotoc.PathsModule, goprotoc.PathsImport, goprotoc.PathsSourceRelative:
+		*thisP = pathsModeFlag(paths)
+		return nil
+	}
+	return fmt.Errorf("unknown paths mode: [%s]", value)
+}
+
+// optionalBoolFlag is a bool flag leaving target nil unless set.
+type optionalBoolFlag struct {
+	target **bool
+}
+
+func (thisP *optionalBoolFlag) String() string {
+	if thisP == nil || thisP.target == nil || *thisP.target == nil {
+		return ""
+	}
+	return strconv.FormatBool(**thisP.target)
+}
+
+func (thisP *optionalBoolFlag) Set(value string) error {
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("expect true or false: [%s]", value)
+	}
+	*thisP.target = &parsed
+	return nil
+}
+
+func (thisP *optionalBoolFlag) IsBoolFlag() bool {
+	return true
+}
+
+type backendFlag goprotoc.Backend
+
+func (thisP *backendFlag) String() string {
+	return string(*thisP)
+}
+
+func (thisP *backendFlag) Set(value string) error {
+	switch backend := goprotoc.Backend(value); backend {
+	case goprotoc.BackendProtoc, goprotoc.BackendGo:
+		*thisP = backendFlag(backend)
+		return nil
+	}
+	return fmt.Errorf("unknown backend: [%s]", value)
+}
+
+type diagnosticFormatFlag goprotoc.DiagnosticFormat
+
+func (thisP *diagnosticFormatFlag) String() string {
+	return string(*thisP)
+}
+
+func (thisP *diagnosticFormatFlag) Set(value string) error {
+	switch format := goprotoc.DiagnosticFormat(value); format {
+	case goprotoc.DiagnosticFormatVet, goprotoc.DiagnosticFormatGitHub:
+		*thisP = diagnosticFormatFlag(format)
+		return nil
+	case "raw":
+		*thisP = diagnosticFormatFlag(goprotoc.DiagnosticFormatRaw)
+		return nil
+	}
+	return fmt.Errorf("unknown diagnostic format: [%s]", value)
+}
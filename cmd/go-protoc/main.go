@@ -0,0 +1,159 @@
+// Command go-protoc generates Go code from .proto files with a cached protoc and plugins.
+//
+//	//go:generate go run github.com/sky91/go-protoc/cmd/go-protoc generate
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	goprotoc "github.com/sky91/go-protoc"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `usage: go-protoc <command> [flags] [package]
+
+commands:
+  generate         generate Go code for the package (default: the go:generate file or the current dir), -all for the module
+  check            fail if the generated Go code of the package is out of date, -all for the module
+  clean            remove the CleanDir dirs of the package, -dry-run to print what would be removed
+  print-args       print the protoc arguments without running protoc
+  plugins install  install the enabled plugins into the cache
+  cache ls         list the shared protoc and plugin cache
+  cache prune      remove cache entries, see -older-than
+
+run "go-protoc <command> -h" for the flags of a command
+`
+
+func main() {
+	if err := run(context.Background(), os.Args[1:]); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "go-protoc: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		_, _ = fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("missing command")
+	}
+	command, args := args[0], args[1:]
+	if (command == "plugins" || command == "cache") && len(args) > 0 {
+		command, args = command+" "+args[0], args[1:]
+	}
+
+	switch command {
+	case "generate", "check":
+		generator, opts, err := parseGeneratorFlags(command, args)
+		if err != nil {
+			return err
+		}
+		generator.Check = generator.Check || command == "check"
+		if opts.all {
+			results, err := generator.RunModule(ctx)
+			printPackageResults(results)
+			return err
+		}
+		return generator.Run(ctx)
+	case "clean":
+		generator, opts, err := parseGeneratorFlags(command, args)
+		if err != nil {
+			return err
+		}
+		if opts.dryRun {
+			cleanPaths, err := generator.PlanClean(ctx)
+			if err != nil {
+				return err
+			}
+			for _, path := range cleanPaths {
+				fmt.Println(path)
+			}
+			return nil
+		}
+		return generator.Clean(ctx)
+	case "print-args":
+		generator, _, err := parseGeneratorFlags(command, args)
+		if err != nil {
+			return err
+		}
+		protocArgs, err := generator.ProtocArgs(ctx)
+		if err != nil {
+			return err
+		}
+		for i, args := range protocArgs {
+			if i > 0 {
+				fmt.Println()
+			}
+			for _, arg := range args {
+				fmt.Println(arg)
+			}
+		}
+		return nil
+	case "plugins install":
+		generator, _, err := parseGeneratorFlags(command, args)
+		if err != nil {
+			return err
+		}
+		binaries, err := generator.InstallPlugins(ctx)
+		if err != nil {
+			return err
+		}
+		for _, binary := range binaries {
+			fmt.Println(binary)
+		}
+		return nil
+	case "cache ls":
+		if err := flag.NewFlagSet(command, flag.ExitOnError).Parse(args); err != nil {
+			return err
+		}
+		entries, err := goprotoc.ListCache()
+		if err != nil {
+			return err
+		}
+		printCacheEntries(entries)
+		return nil
+	case "cache prune":
+		flagSet := flag.NewFlagSet(command, flag.ExitOnError)
+		olderThan := flagSet.Duration("older-than", 0, "only prune entries not used within this duration, 0 prunes everything")
+		lockTimeout := flagSet.Duration("lock-timeout", 0, "max wait for another process using a cache entry")
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		generator := &goprotoc.Generator{LockTimeout: *lockTimeout}
+		if err := generator.Init(); err != nil {
+			return err
+		}
+		pruned, err := generator.PruneCache(ctx, *olderThan)
+		printCacheEntries(pruned)
+		return err
+	default:
+		_, _ = fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command: [%s]", command)
+	}
+}
+
+func printPackageResults(results []goprotoc.PackageResult) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "PACKAGE\tRESULT\tDURATION")
+	for _, result := range results {
+		status := "ok"
+		if result.Err != nil {
+			status = "FAIL: " + strings.SplitN(result.Err.Error(), "\n", 2)[0]
+		}
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\n", result.ImportPath, status, result.Duration.Round(time.Millisecond))
+	}
+	_ = writer.Flush()
+}
+
+func printCacheEntries(entries []goprotoc.CacheEntry) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "KIND\tNAME\tSIZE\tMODIFIED\tPATH")
+	for _, entry := range entries {
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%.1fM\t%s\t%s\n",
+			entry.Kind, entry.Name, float64(entry.Size)/(1<<20), entry.ModTime.Format(time.DateTime), entry.Path)
+	}
+	_ = writer.Flush()
+}
@@ -0,0 +1,429 @@
+package goprotoc
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ConfigFileNames are the config file names LoadConfig looks for in every dir from the module root to the target dir.
+var ConfigFileNames = []string{"go-protoc.json", "go-protoc.yaml", "go-protoc.yml"}
+
+// ConfigError points at the key of a config file that failed validation.
+type ConfigError struct {
+	File    string
+	Line    int
+	Column  int
+	Key     string
+	Message string
+}
+
+func (thisP *ConfigError) Error() string {
+	if thisP.Key == "" {
+		return fmt.Sprintf("%s:%d:%d: %s", thisP.File, thisP.Line, thisP.Column, thisP.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", thisP.File, thisP.Line, thisP.Column, thisP.Key, thisP.Message)
+}
+
+// LoadConfig returns an initialized Generator targeting dir, configured by the config files from the module root down to dir.
+// An empty dir reads the config files for the working dir and leaves the target to GOFILE, as in go generate.
+// A config file in a sub dir overrides the keys it sets; plugins are merged by name, protocSHA256 by OsArch and goOptions by field.
+func LoadConfig(dir string) (*Generator, error) {
+	generator := &Generator{TargetDir: dir}
+	if dir == "" {
+		dir = "."
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Abs() error: [%w]", err)
+	}
+	for _, configDir := range listConfigDirs(dir) {
+		configFile, err := findConfigFile(configDir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "findConfigFile() error")
+		}
+		if configFile == "" {
+			continue
+		}
+		if err = generator.applyConfigFile(configFile); err != nil {
+			return nil, err
+		}
+	}
+	if err = generator.Init(); err != nil {
+		return nil, errors.Wrapf(err, "Init() error")
+	}
+	return generator, nil
+}
+
+// listConfigDirs returns the dirs from the module root containing dir down to dir, or only dir if it is not in a module.
+func listConfigDirs(dir string) []string {
+	dirs := []string{dir}
+	for current := dir; ; {
+		if _, err := os.Stat(filepath.Join(current, "go.mod")); err == nil {
+			return dirs
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return []string{dir}
+		}
+		current = parent
+		dirs = append([]string{current}, dirs...)
+	}
+}
+
+func findConfigFile(dir string) (string, error) {
+	var found []string
+	for _, name := range ConfigFileNames {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			found = append(found, filepath.Join(dir, name))
+		}
+	}
+	if len(found) > 1 {
+		return "", fmt.Errorf("more than one config file in dir: %v", found)
+	}
+	if len(found) == 0 {
+		return "", nil
+	}
+	return found[0], nil
+}
+
+func (thisP *Generator) applyConfigFile(configFile string) error {
+	configBytes, err := os.ReadFile(configFile)
+	if err != nil {
+		return errors.Wrapf(err, "os.ReadFile() error")
+	}
+	doc := yaml.Node{}
+	if err = yaml.Unmarshal(configBytes, &doc); err != nil {
+		return fmt.Errorf("%s: %w", configFile, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	decoder := configDecoder{file: configFile}
+	return decoder.mapping(doc.Content[0], "", func(name, key string, value *yaml.Node) error {
+		switch name {
+		case "protoDir":
+			return decoder.str(value, key, &thisP.ProtoDir)
+		case "cleanDir":
+			return decoder.str(value, key, &thisP.CleanDir)
+		case "safeClean":
+			return decoder.boolean(value, key, &thisP.SafeClean)
+		case "protocDownloadUrl":
+			return decoder.str(value, key, &thisP.ProtocDownloadUrl)
+		case "protocVer":
+			return decoder.str(value, key, &thisP.ProtocVer)
+		case "protocGenGoGrpcVer":
+			return decoder.str(value, key, &thisP.ProtocGenGoGrpcVer)
+		case "protocSHA256":
+			return decoder.mapping(value, key, func(osArch, key string, hash *yaml.Node) error {
+				if thisP.ProtocSHA256 == nil {
+					thisP.ProtocSHA256 = map[string]string{}
+				}
+				sha256 := ""
+				if err := decoder.str(hash, key, &sha256); err != nil {
+					return err
+				}
+				thisP.ProtocSHA256[osArch] = sha256
+				return nil
+			})
+		case "allowUnpinned":
+			return decoder.boolean(value, key, &thisP.AllowUnpinned)
+		case "protocLocalPath":
+			return decoder.str(value, key, &thisP.ProtocLocalPath)
+		case "offline":
+			return decoder.boolean(value, key, &thisP.Offline)
+		case "lockTimeout":
+			return decoder.duration(value, key, &thisP.LockTimeout)
+		case "protocOpts":
+			return decoder.strs(value, key, &thisP.CustomProtocOpts)
+		case "extraProtoPaths":
+			return decoder.strs(value, key, &thisP.ExtraProtoPaths)
+		case "extraOutputs":
+			return decoder.mapping(value, key, func(name, key string, outDir *yaml.Node) error {
+				if thisP.ExtraOutputs == nil {
+					thisP.ExtraOutputs = map[string]string{}
+				}
+				dir := ""
+				if err := decoder.str(outDir, key, &dir); err != nil {
+					return err
+				}
+				if filepath.IsAbs(dir) {
+					return decoder.errorf(outDir, key, "expect a dir relative to the module dir")
+				}
+				thisP.ExtraOutputs[name] = dir
+				return nil
+			})
+		case "pluginParams":
+			return decoder.mapping(value, key, func(name, key string, params *yaml.Node) error {
+				if thisP.PluginParams == nil {
+					thisP.PluginParams = map[string][]string{}
+				}
+				var values []string
+				if err := decoder.strs(params, key, &values); err != nil {
+					return err
+				}
+				thisP.PluginParams[name] = values
+				return nil
+			})
+		case "disableJetBrains":
+			return decoder.boolean(value, key, &thisP.DisableJetBrains)
+		case "ideIntegrations":
+			var names []string
+			if err := decoder.strs(value, key, &names); err != nil {
+				return err
+			}
+			thisP.IDEIntegrations = make([]IDEIntegration, 0, len(names))
+			for i, name := range names {
+				integration, err := IDEIntegrationByName(name)
+				if err != nil {
+					return decoder.errorf(value.Content[i], fmt.Sprintf("%s[%d]", key, i), "expect one of %v, got [%s]", IDEIntegrationNames(), name)
+				}
+				thisP.IDEIntegrations = append(thisP.IDEIntegrations, integration)
+			}
+			return nil
+		case "goOptions":
+			return decoder.goOptions(value, key, &thisP.GoOptions)
+		case "plugins":
+			return decoder.plugins(value, key, &thisP.Plugins)
+		case "descriptorSet":
+			return decoder.mapping(value, key, func(name, key string, value *yaml.Node) error {
+				switch name {
+				case "out":
+					return decoder.str(value, key, &thisP.DescriptorSet.Out)
+				case "includeImports":
+					return decoder.boolean(value, key, &thisP.DescriptorSet.IncludeImports)
+				case "includeSourceInfo":
+					return decoder.boolean(value, key, &thisP.DescriptorSet.IncludeSourceInfo)
+				case "goFile":
+					return decoder.str(value, key, &thisP.DescriptorSet.GoFile)
+				case "goPackageName":
+					return decoder.str(value, key, &thisP.DescriptorSet.GoPackageName)
+				}
+				return errUnknownConfigKey
+			})
+		case "backend":
+			backend := string(thisP.Backend)
+			if err := decoder.enum(value, key, &backend, string(BackendProtoc), string(BackendGo)); err != nil {
+				return err
+			}
+			thisP.Backend = Backend(backend)
+			return nil
+		case "diagnosticFormat":
+			format := string(thisP.DiagnosticFormat)
+			if err := decoder.enum(value, key, &format, "raw", string(DiagnosticFormatVet), string(DiagnosticFormatGitHub)); err != nil {
+				return err
+			}
+			thisP.DiagnosticFormat = DiagnosticFormat(strings.TrimPrefix(format, "raw"))
+			return nil
+		case "check":
+			return decoder.boolean(value, key, &thisP.Check)
+		case "incremental":
+			return decoder.boolean(value, key, &thisP.Incremental)
+		case "parallelism":
+			return decoder.integer(value, key, &thisP.Parallelism)
+		}
+		return errUnknownConfigKey
+	})
+}
+
+var errUnknownConfigKey = errors.New("unknown key")
+
+type configDecoder struct {
+	file string
+}
+
+func (thisV configDecoder) errorf(node *yaml.Node, key string, format string, args ...any) error {
+	return &ConfigError{File: thisV.file, Line: node.Line, Column: node.Column, Key: key, Message: fmt.Sprintf(format, args...)}
+}
+
+// mapping calls fn with the name and full key of every entry of a mapping node.
+// fn returns errUnknownConfigKey to report the entry's key as unknown.
+func (thisV configDecoder) mapping(node *yaml.Node, key string, fn func(name, key string, value *yaml.Node) error) error {
+	if node.Kind != yaml.MappingNode {
+		return thisV.errorf(node, key, "expect a mapping")
+	}
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		entryKey := keyNode.Value
+		if key != "" {
+			entryKey = key + "." + keyNode.Value
+		}
+		if seen[keyNode.Value] {
+			return thisV.errorf(keyNode, entryKey, "duplicate key")
+		}
+		seen[keyNode.Value] = true
+		if err := fn(keyNode.Value, entryKey, valueNode); err == errUnknownConfigKey {
+			return thisV.errorf(keyNode, entryKey, "unknown key")
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (thisV configDecoder) str(node *yaml.Node, key string, target *string) error {
+	if node.Kind != yaml.ScalarNode || node.Tag == "!!null" || node.Tag == "!!bool" {
+		return thisV.errorf(node, key, "expect a string")
+	}
+	*target = node.Value
+	return nil
+}
+
+func (thisV configDecoder) boolean(node *yaml.Node, key string, target *bool) error {
+	if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+		return thisV.errorf(node, key, "expect true or false")
+	}
+	return node.Decode(target)
+}
+
+func (thisV configDecoder) integer(node *yaml.Node, key string, target *int) error {
+	if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+		return thisV.errorf(node, key, "expect an integer")
+	}
+	return node.Decode(target)
+}
+
+func (thisV configDecoder) duration(node *yaml.Node, key string, target *time.Duration) error {
+	value := ""
+	if err := thisV.str(node, key, &value); err != nil {
+		return thisV.errorf(node, key, "expect a duration like \"5m\"")
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return thisV.errorf(node, key, "expect a duration like \"5m\": %v", err)
+	}
+	*target = duration
+	return nil
+}
+
+func (thisV configDecoder) enum(node *yaml.Node, key string, target *string, values ...string) error {
+	value := ""
+	if err := thisV.str(node, key, &value); err != nil {
+		return err
+	}
+	for _, allowed := range values {
+		if value == allowed {
+			*target = value
+			return nil
+		}
+	}
+	return thisV.errorf(node, key, "expect one of %v, got [%s]", values, value)
+}
+
+func (thisV configDecoder) strs(node *yaml.Node, key string, target *[]string) error {
+	if node.Kind != yaml.SequenceNode {
+		return thisV.errorf(node, key, "expect a list of strings")
+	}
+	values := make([]string, 0, len(node.Content))
+	for i, item := range node.Content {
+		value := ""
+		if err := thisV.str(item, fmt.Sprintf("%s[%d]", key, i), &value); err != nil {
+			return err
+		}
+		values = append(values, value)
+	}
+	*target = values
+	return nil
+}
+
+func (thisV configDecoder) plugins(node *yaml.Node, key string, target *[]Plugin) error {
+	if node.Kind != yaml.SequenceNode {
+		return thisV.errorf(node, key, "expect a list of plugins")
+	}
+	for i, item := range node.Content {
+		itemKey := fmt.Sprintf("%s[%d]", key, i)
+		plugin := Plugin{}
+		if err := thisV.mapping(item, itemKey, func(name, fieldKey string, value *yaml.Node) error {
+			switch name {
+			case "name":
+				return thisV.str(value, fieldKey, &plugin.Name)
+			case "pkg":
+				return thisV.str(value, fieldKey, &plugin.Pkg)
+			case "version":
+				return thisV.str(value, fieldKey, &plugin.Version)
+			case "outDir":
+				if err := thisV.str(value, fieldKey, &plugin.OutDir); err != nil {
+					return err
+				}
+				if filepath.IsAbs(plugin.OutDir) {
+					return thisV.errorf(value, fieldKey, "expect a dir relative to the module dir")
+				}
+				return nil
+			case "opts":
+				return thisV.strs(value, fieldKey, &plugin.Opts)
+			case "enableIfPkg":
+				return thisV.str(value, fieldKey, &plugin.EnableIfPkg)
+			case "disabled":
+				return thisV.boolean(value, fieldKey, &plugin.Disabled)
+			}
+			return errUnknownConfigKey
+		}); err != nil {
+			return err
+		}
+		if plugin.Pkg == "" && (plugin.Name == "" || !plugin.Disabled) {
+			return thisV.errorf(item, itemKey, "pkg is required, or name with disabled: true to disable a plugin")
+		}
+		if j := indexPlugin(*target, plugin.getName()); j >= 0 {
+			(*target)[j] = plugin
+		} else {
+			*target = append(*target, plugin)
+		}
+	}
+	return nil
+}
+
+// goOptions sets the fields present in node, merging mappings with the ones of outer config files.
+func (thisV configDecoder) goOptions(node *yaml.Node, key string, target *GoOptions) error {
+	return thisV.mapping(node, key, func(name, key string, value *yaml.Node) error {
+		switch name {
+		case "paths":
+			paths := string(target.Paths)
+			if err := thisV.enum(value, key, &paths, string(PathsModule), string(PathsImport), string(PathsSourceRelative)); err != nil {
+				return err
+			}
+			target.Paths = PathsMode(paths)
+			return nil
+		case "outDir":
+			if err := thisV.str(value, key, &target.OutDir); err != nil {
+				return err
+			}
+			if filepath.IsAbs(target.OutDir) {
+				return thisV.errorf(value, key, "expect a dir relative to the module dir")
+			}
+			return nil
+		case "mappings":
+			return thisV.mapping(value, key, func(file, key string, importPath *yaml.Node) error {
+				if target.Mappings == nil {
+					target.Mappings = map[string]string{}
+				}
+				path := ""
+				if err := thisV.str(importPath, key, &path); err != nil {
+					return err
+				}
+				target.Mappings[file] = path
+				return nil
+			})
+		case "defaultApiLevel":
+			return thisV.enum(value, key, &target.DefaultAPILevel, "API_OPEN", "API_HYBRID", "API_OPAQUE")
+		case "grpcRequireUnimplementedServers":
+			return thisV.optionalBoolean(value, key, &target.GrpcRequireUnimplementedServers)
+		case "grpcUseGenericStreams":
+			return thisV.optionalBoolean(value, key, &target.GrpcUseGenericStreams)
+		}
+		return errUnknownConfigKey
+	})
+}
+
+func (thisV configDecoder) optionalBoolean(node *yaml.Node, key string, target **bool) error {
+	value := false
+	if err := thisV.boolean(node, key, &value); err != nil {
+		return err
+	}
+	*target = &value
+	return nil
+}
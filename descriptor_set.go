@@ -0,0 +1,285 @@
+package goprotoc
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sky91/go-protoc/internal"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// DescriptorSet makes Run also write a binary FileDescriptorSet of the generated files, as protoc --descriptor_set_out.
+// It covers the files generated into the module of the package; Out and GoFile are relative to the package dir,
+// so every package RunModule generates gets its own.
+type DescriptorSet struct {
+	Out               string // slash path relative to the package dir, e.g. proto_gen_go/descriptor_set.binpb; empty to disable
+	IncludeImports    bool   // also include the imported files, as protoc --include_imports
+	IncludeSourceInfo bool   // keep comments and positions, as protoc --include_source_info
+	GoFile            string // optional Go file relative to the package dir embedding Out, which must be in its dir or below
+	GoPackageName     string // package name of GoFile, defaults to the package already in its dir, else the name of its dir
+}
+
+const descriptorSetPluginName = "descriptor_set"
+
+func (thisV DescriptorSet) validate() error {
+	if !filepath.IsLocal(filepath.FromSlash(thisV.Out)) {
+		return fmt.Errorf("DescriptorSet.Out must be relative to the package dir: [%s]", thisV.Out)
+	}
+	if thisV.GoFile == "" {
+		return nil
+	}
+	if !filepath.IsLocal(filepath.FromSlash(thisV.GoFile)) || !strings.HasSuffix(thisV.GoFile, ".go") {
+		return fmt.Errorf("DescriptorSet.GoFile must be a .go file relative to the package dir: [%s]", thisV.GoFile)
+	}
+	if _, err := thisV.embedPattern(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// inModule returns a copy with Out and GoFile of pkg made relative to moduleDir, and the package name of GoFile resolved.
+func (thisV DescriptorSet) inModule(moduleDir string, pkg *internal.PackagePublic) (*DescriptorSet, error) {
+	if thisV.GoFile != "" && thisV.GoPackageName == "" {
+		goFileDir := filepath.Join(pkg.Dir, filepath.Dir(filepath.FromSlash(thisV.GoFile)))
+		if goFileDir == filepath.Clean(pkg.Dir) && pkg.Name != "" {
+			thisV.GoPackageName = pkg.Name
+		} else {
+			packageName, err := goPackageNameInDir(goFileDir, filepath.Base(thisV.GoFile))
+			if err != nil {
+				return nil, errors.Wrapf(err, "goPackageNameInDir() error")
+			}
+			thisV.GoPackageName = packageName
+		}
+	}
+	prefix := relSlashPrefix(moduleDir, pkg.Dir)
+	thisV.Out = prefix + thisV.Out
+	if thisV.GoFile != "" {
+		thisV.GoFile = prefix + thisV.GoFile
+	}
+	return &thisV, nil
+}
+
+// goPackageNameInDir returns the package clause of the first non-test .go file in dir other than skipFile, "" if there is none.
+func goPackageNameInDir(dir, skipFile string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", errors.Wrapf(err, "os.ReadDir() error")
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == skipFile || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, parser.PackageClauseOnly)
+		if err != nil {
+			continue
+		}
+		return file.Name.Name, nil
+	}
+	return "", nil
+}
+
+func (thisV DescriptorSet) protocArgs(outDir string) []string {
+	args := []string{"--descriptor_set_out=" + filepath.Join(outDir, filepath.FromSlash(thisV.Out))}
+	if thisV.IncludeImports {
+		args = append(args, "--include_imports")
+	}
+	if thisV.IncludeSourceInfo {
+		args = append(args, "--include_source_info")
+	}
+	return args
+}
+
+// build returns the descriptor set protoc would write for request, which has imports and source info.
+func (thisV DescriptorSet) build(request *pluginpb.CodeGeneratorRequest) ([]byte, error) {
+	toGenerate := map[string]bool{}
+	for _, file := range request.FileToGenerate {
+		toGenerate[file] = true
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, file := range request.ProtoFile {
+		if !thisV.IncludeImports && !toGenerate[file.GetName()] {
+			continue
+		}
+		if !thisV.IncludeSourceInfo && file.SourceCodeInfo != nil {
+			file = proto.Clone(file).(*descriptorpb.FileDescriptorProto)
+			file.SourceCodeInfo = nil
+		}
+		set.File = append(set.File, file)
+	}
+	setBytes, err := proto.MarshalOptions{Deterministic: true}.Marshal(set)
+	if err != nil {
+		return nil, errors.Wrapf(err, "proto.Marshal() error")
+	}
+	return setBytes, nil
+}
+
+// embedPattern is Out relative to the dir of GoFile.
+func (thisV DescriptorSet) embedPattern() (string, error) {
+	goFileDir := path.Dir(thisV.GoFile)
+	if goFileDir == "." {
+		return thisV.Out, nil
+	}
+	if !strings.HasPrefix(thisV.Out, goFileDir+"/") {
+		return "", fmt.Errorf("DescriptorSet.Out must be in the dir of GoFile or below to be embedded: [%s], GoFile=[%s]", thisV.Out, thisV.GoFile)
+	}
+	return strings.TrimPrefix(thisV.Out, goFileDir+"/"), nil
+}
+
+func (thisV DescriptorSet) getGoPackageName() string {
+	if thisV.GoPackageName != "" {
+		return thisV.GoPackageName
+	}
+	name := regexp.MustCompile(`\W+`).ReplaceAllString(path.Base(path.Dir(thisV.GoFile)), "")
+	if name == "" || name == "." || (name[0] >= '0' && name[0] <= '9') {
+		name = "descriptorset"
+	}
+	return name
+}
+
+// goFileContent is the Go file embedding the descriptor set as a []byte and a protoregistry.Files.
+func (thisV DescriptorSet) goFileContent() ([]byte, error) {
+	embedPattern, err := thisV.embedPattern()
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.Buffer{}
+	if err = descriptorSetGoFileTemplate.Execute(&buf, map[string]string{
+		"PackageName":  thisV.getGoPackageName(),
+		"EmbedPattern": embedPattern,
+	}); err != nil {
+		return nil, errors.Wrapf(err, "descriptorSetGoFileTemplate.Execute() error")
+	}
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrapf(err, "format.Source() error")
+	}
+	return formatted, nil
+}
+
+// generatedFiles returns the descriptor set and its Go file for Generator.Generate.
+func (thisV DescriptorSet) generatedFiles(request *pluginpb.CodeGeneratorRequest) ([]GeneratedFile, error) {
+	setBytes, err := thisV.build(request)
+	if err != nil {
+		return nil, errors.Wrapf(err, "build() error")
+	}
+	files := []GeneratedFile{{Name: thisV.Out, Content: setBytes, Plugin: descriptorSetPluginName}}
+	if thisV.GoFile != "" {
+		content, err := thisV.goFileContent()
+		if err != nil {
+			return nil, errors.Wrapf(err, "goFileContent() error")
+		}
+		files = append(files, GeneratedFile{Name: thisV.GoFile, Content: content, Plugin: descriptorSetPluginName})
+	}
+	return files, nil
+}
+
+// writeGoFile writes the Go file embedding the descriptor set written into outDir.
+func (thisV DescriptorSet) writeGoFile(outDir string) error {
+	content, err := thisV.goFileContent()
+	if err != nil {
+		return err
+	}
+	goFile := filepath.Join(outDir, filepath.FromSlash(thisV.GoFile))
+	if err = os.MkdirAll(filepath.Dir(goFile), 0755); err != nil {
+		return errors.Wrapf(err, "os.MkdirAll() error")
+	}
+	if err = os.WriteFile(goFile, content, 0666); err != nil {
+		return errors.Wrapf(err, "os.WriteFile() error")
+	}
+	return nil
+}
+
+var descriptorSetGoFileTemplate = template.Must(template.New("descriptorSetGoFile").Parse(`// Code generated by go-protoc. DO NOT EDIT.
+
+package {{.PackageName}}
+
+import (
+	_ "embed"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"sync"
+)
+
+// FileDescriptorSet is the binary google.protobuf.FileDescriptorSet of the generated files.
+//
+//go:embed {{.EmbedPattern}}
+var FileDescriptorSet []byte
+
+var (
+	filesOnce sync.Once
+	files     *protoregistry.Files
+	filesErr  error
+)
+
+// Files returns the files of FileDescriptorSet, resolving imports it does not include from protoregistry.GlobalFiles.
+func Files() (*protoregistry.Files, error) {
+	filesOnce.Do(func() {
+		files, filesErr = loadFiles()
+	})
+	return files, filesErr
+}
+
+func loadFiles() (*protoregistry.Files, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(FileDescriptorSet, set); err != nil {
+		return nil, err
+	}
+	files := &protoregistry.Files{}
+	pending := set.File
+	for len(pending) > 0 {
+		var next []*descriptorpb.FileDescriptorProto
+		var lastErr error
+		for _, fileProto := range pending {
+			file, err := protodesc.NewFile(fileProto, filesResolver{files})
+			if err == nil {
+				err = files.RegisterFile(file)
+			}
+			if err != nil {
+				next, lastErr = append(next, fileProto), err
+			}
+		}
+		if len(next) == len(pending) {
+			return nil, lastErr
+		}
+		pending = next
+	}
+	return files, nil
+}
+
+// filesResolver resolves from the files of FileDescriptorSet, then from protoregistry.GlobalFiles.
+type filesResolver struct {
+	files *protoregistry.Files
+}
+
+func (r filesResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if file, err := r.files.FindFileByPath(path); err == nil {
+		return file, nil
+	}
+	return protoregistry.GlobalFiles.FindFileByPath(path)
+}
+
+func (r filesResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if descriptor, err := r.files.FindDescriptorByName(name); err == nil {
+		return descriptor, nil
+	}
+	return protoregistry.GlobalFiles.FindDescriptorByName(name)
+}
+`))
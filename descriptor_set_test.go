@@ -0,0 +1,56 @@
+package goprotoc
+
+import (
+	"github.com/sky91/go-protoc/internal"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDescriptorSetInModule(t *testing.T) {
+	moduleDir := t.TempDir()
+	pkgDir := filepath.Join(moduleDir, "api")
+	for file, content := range map[string]string{
+		"api/api.go":             "package apiv1\n",
+		"api/gen/gen.go":         "// Code generated.\n\npackage generated\n",
+		"api/gen/gen_test.go":    "package generated_test\n",
+		"api/gen/set.go":         "package stale\n",
+		"api/only-set/set.go":    "package stale\n",
+		"api/testonly/x_test.go": "package testonly_test\n",
+	} {
+		path := filepath.Join(moduleDir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("os.MkdirAll() error: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("os.WriteFile() error: %v", err)
+		}
+	}
+	pkg := &internal.PackagePublic{Dir: pkgDir, Name: "apiv1"}
+	tests := []struct {
+		goFile        string
+		packageName   string
+		wantGoFile    string
+		wantGoPackage string
+	}{
+		{goFile: "set.go", wantGoFile: "api/set.go", wantGoPackage: "apiv1"},
+		{goFile: "gen/set.go", wantGoFile: "api/gen/set.go", wantGoPackage: "generated"},
+		{goFile: "only-set/set.go", wantGoFile: "api/only-set/set.go", wantGoPackage: "onlyset"},
+		{goFile: "testonly/set.go", wantGoFile: "api/testonly/set.go", wantGoPackage: "testonly"},
+		{goFile: "new/set.go", wantGoFile: "api/new/set.go", wantGoPackage: "new"},
+		{goFile: "gen/set.go", packageName: "custom", wantGoFile: "api/gen/set.go", wantGoPackage: "custom"},
+	}
+	for _, test := range tests {
+		descriptorSet := DescriptorSet{Out: "set.binpb", GoFile: test.goFile, GoPackageName: test.packageName}
+		got, err := descriptorSet.inModule(moduleDir, pkg)
+		if err != nil {
+			t.Fatalf("inModule() error: %v", err)
+		}
+		if got.Out != "api/set.binpb" || got.GoFile != test.wantGoFile {
+			t.Errorf("inModule(%s) Out=[%s], GoFile=[%s], want [api/set.binpb], [%s]", test.goFile, got.Out, got.GoFile, test.wantGoFile)
+		}
+		if name := got.getGoPackageName(); name != test.wantGoPackage {
+			t.Errorf("inModule(%s) package name = [%s], want [%s]", test.goFile, name, test.wantGoPackage)
+		}
+	}
+}
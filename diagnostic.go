@@ -0,0 +1,184 @@
+package goprotoc
+
+import (
+	"fmt"
+	"github.com/bufbuild/protocompile/reporter"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a single protoc error or warning.
+// File is relative to the proto dir when the file is inside it; Line and Column are 0 when unknown.
+type Diagnostic struct {
+	File     string
+	Line     int
+	Column   int
+	Severity Severity
+	Message  string
+
+	absFile string
+}
+
+func (thisV Diagnostic) String() string {
+	return thisV.format(thisV.File)
+}
+
+func (thisV Diagnostic) format(file string) string {
+	switch {
+	case file == "":
+		return fmt.Sprintf("%s: %s", thisV.Severity, thisV.Message)
+	case thisV.Line == 0:
+		return fmt.Sprintf("%s: %s: %s", file, thisV.Severity, thisV.Message)
+	default:
+		return fmt.Sprintf("%s:%d:%d: %s: %s", file, thisV.Line, thisV.Column, thisV.Severity, thisV.Message)
+	}
+}
+
+// ProtocError is returned by Run when protoc, or the Go backend, fails to compile the .proto files,
+// or when the go_package check before compiling fails.
+type ProtocError struct {
+	Diagnostics []Diagnostic
+	Err         error
+}
+
+func (thisP *ProtocError) Error() string {
+	buf := strings.Builder{}
+	buf.WriteString(thisP.Err.Error())
+	for _, diagnostic := range thisP.Diagnostics {
+		buf.WriteString("\n\t" + diagnostic.String())
+	}
+	return buf.String()
+}
+
+func (thisP *ProtocError) Unwrap() error {
+	return thisP.Err
+}
+
+// DiagnosticFormat controls how Run prints protoc diagnostics to stderr.
+type DiagnosticFormat string
+
+const (
+	// DiagnosticFormatRaw passes protoc stderr through unchanged.
+	DiagnosticFormatRaw DiagnosticFormat = ""
+	// DiagnosticFormatVet prints file:line:col: message like go vet, with paths relative to the working dir.
+	DiagnosticFormatVet DiagnosticFormat = "vet"
+	// DiagnosticFormatGitHub prints GitHub Actions workflow commands, with paths relative to GITHUB_WORKSPACE.
+	DiagnosticFormatGitHub DiagnosticFormat = "github"
+)
+
+var (
+	diagnosticPosRegexp  = regexp.MustCompile(`^(.+?):(\d+):(\d+): (.*)$`)
+	diagnosticFileRegexp = regexp.MustCompile(`^(.+?\.proto): (.*)$`)
+)
+
+func parseProtocDiagnostics(stderr string, protoPaths []string, protoDir string) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		diagnostic := Diagnostic{Severity: SeverityError, Message: line}
+		if match := diagnosticPosRegexp.FindStringSubmatch(line); match != nil {
+			diagnostic.File, diagnostic.Message = match[1], match[4]
+			_, _ = fmt.Sscan(match[2], &diagnostic.Line)
+			_, _ = fmt.Sscan(match[3], &diagnostic.Column)
+		} else if match = diagnosticFileRegexp.FindStringSubmatch(line); match != nil {
+			diagnostic.File, diagnostic.Message = match[1], match[2]
+		}
+		if message, ok := strings.CutPrefix(diagnostic.Message, "warning: "); ok {
+			diagnostic.Severity, diagnostic.Message = SeverityWarning, message
+		}
+		if diagnostic.File != "" {
+			diagnostic.File, diagnostic.absFile = resolveDiagnosticFile(diagnostic.File, protoPaths, protoDir)
+		}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	return diagnostics
+}
+
+func newProtocompileDiagnostic(err reporter.ErrorWithPos, severity Severity, protoPaths []string, protoDir string) Diagnostic {
+	pos := err.GetPosition()
+	diagnostic := Diagnostic{Line: pos.Line, Column: pos.Col, Severity: severity, Message: err.Unwrap().Error()}
+	diagnostic.File, diagnostic.absFile = resolveDiagnosticFile(pos.Filename, protoPaths, protoDir)
+	return diagnostic
+}
+
+// resolveDiagnosticFile finds a proto_path relative file on disk and makes it relative to protoDir if inside it.
+func resolveDiagnosticFile(file string, protoPaths []string, protoDir string) (relFile string, absFile string) {
+	absFile = file
+	if !filepath.IsAbs(file) {
+		for _, protoPath := range protoPaths {
+			candidate := filepath.Join(protoPath, filepath.FromSlash(file))
+			if _, err := os.Stat(candidate); err == nil {
+				absFile = candidate
+				break
+			}
+		}
+	}
+	if !filepath.IsAbs(absFile) {
+		return file, ""
+	}
+	if rel, err := filepath.Rel(protoDir, absFile); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel), absFile
+	}
+	return absFile, absFile
+}
+
+func (thisP *Generator) printDiagnostics(diagnostics []Diagnostic) {
+	for _, diagnostic := range diagnostics {
+		switch thisP.DiagnosticFormat {
+		case DiagnosticFormatVet:
+			_, _ = fmt.Fprintln(os.Stderr, diagnostic.format(relToDir(diagnostic, lookupWd())))
+		case DiagnosticFormatGitHub:
+			workspace, ok := os.LookupEnv("GITHUB_WORKSPACE")
+			if !ok {
+				workspace = lookupWd()
+			}
+			props := make([]string, 0, 3)
+			if file := relToDir(diagnostic, workspace); file != "" {
+				props = append(props, "file="+escapeGitHubProperty(file))
+			}
+			if diagnostic.Line > 0 {
+				props = append(props, fmt.Sprintf("line=%d", diagnostic.Line), fmt.Sprintf("col=%d", diagnostic.Column))
+			}
+			command := "::" + string(diagnostic.Severity)
+			if len(props) > 0 {
+				command += " " + strings.Join(props, ",")
+			}
+			_, _ = fmt.Fprintf(os.Stderr, "%s::%s\n", command, escapeGitHubData(diagnostic.Message))
+		}
+	}
+}
+
+func relToDir(diagnostic Diagnostic, dir string) string {
+	if diagnostic.absFile == "" || dir == "" {
+		return diagnostic.File
+	}
+	if rel, err := filepath.Rel(dir, diagnostic.absFile); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return diagnostic.absFile
+}
+
+func lookupWd() string {
+	wd, _ := os.Getwd()
+	return wd
+}
+
+func escapeGitHubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
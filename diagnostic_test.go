@@ -0,0 +1,41 @@
+package goprotoc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseProtocDiagnostics(t *testing.T) {
+	protoDir := t.TempDir()
+	includeDir := t.TempDir()
+	for _, file := range []string{filepath.Join(protoDir, "demo", "v1", "demo.proto"), filepath.Join(includeDir, "dep.proto")} {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(`syntax = "proto3";`), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stderr := "demo/v1/demo.proto:5:8: \"Foo\" is not defined.\r\n" +
+		"\n" +
+		"dep.proto:1:1: warning: Import unused.proto is unused.\n" +
+		"demo/v1/demo.proto: Import \"missing.proto\" was not found or had errors.\n" +
+		"other.proto:2:3: not on disk\n" +
+		"--go_out: protoc-gen-go: Plugin failed with status code 1.\n"
+	got := parseProtocDiagnostics(stderr, []string{includeDir, protoDir}, protoDir)
+	want := []Diagnostic{
+		{File: "demo/v1/demo.proto", Line: 5, Column: 8, Severity: SeverityError, Message: "\"Foo\" is not defined.",
+			absFile: filepath.Join(protoDir, "demo", "v1", "demo.proto")},
+		{File: filepath.Join(includeDir, "dep.proto"), Line: 1, Column: 1, Severity: SeverityWarning, Message: "Import unused.proto is unused.",
+			absFile: filepath.Join(includeDir, "dep.proto")},
+		{File: "demo/v1/demo.proto", Severity: SeverityError, Message: "Import \"missing.proto\" was not found or had errors.",
+			absFile: filepath.Join(protoDir, "demo", "v1", "demo.proto")},
+		{File: "other.proto", Line: 2, Column: 3, Severity: SeverityError, Message: "not on disk"},
+		{Severity: SeverityError, Message: "--go_out: protoc-gen-go: Plugin failed with status code 1."},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProtocDiagnostics() =\n%#v\nwant\n%#v", got, want)
+	}
+}
@@ -0,0 +1,128 @@
+package goprotoc
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// GeneratedFile is a file a plugin generated, returned by Generate instead of being written.
+type GeneratedFile struct {
+	Name    string // slash path relative to the module dir of the package, as Run would write it
+	Content []byte
+	Plugin  string // name of the plugin that generated the file
+}
+
+// Generate prepares protoc, plugins and proto paths like Run and returns the generated files without writing them,
+// leaving CleanDir, IDE configs and the manifest untouched. Check and Incremental are ignored.
+// ExtraOutputs and the CustomProtocOpts passed to protoc as is are not supported.
+func (thisP *Generator) Generate(ctx context.Context) ([]GeneratedFile, error) {
+	gen, err := thisP.prepareGeneration(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "prepareGeneration() error")
+	}
+	defer gen.close()
+
+	var files []GeneratedFile
+	for _, invocation := range gen.invocations {
+		if len(invocation.protoFiles) == 0 && len(gen.invocations) > 1 {
+			continue
+		}
+		request, err := thisP.compile(gen, invocation)
+		if err != nil {
+			return nil, err
+		}
+		prefix := relSlashPrefix(gen.genPkg.Module.Dir, invocation.moduleDir)
+		if err = thisP.runPlugins(gen.ctx, invocation, request, func(plugin *pluginInvocation, response *pluginpb.CodeGeneratorResponse) error {
+			pluginDir, err := filepath.Rel(invocation.outDir, plugin.out)
+			if err != nil {
+				return errors.Wrapf(err, "filepath.Rel() error")
+			}
+			for _, file := range response.File {
+				if file.GetInsertionPoint() != "" {
+					return fmt.Errorf("insertion point not supported: file=[%s], insertionPoint=[%s]", file.GetName(), file.GetInsertionPoint())
+				}
+				name := path.Join(filepath.ToSlash(pluginDir), file.GetName())
+				if !filepath.IsLocal(filepath.FromSlash(name)) {
+					return fmt.Errorf("%s: illegal file path", file.GetName())
+				}
+				files = append(files, GeneratedFile{Name: prefix + name, Content: []byte(file.GetContent()), Plugin: plugin.name})
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		if invocation.descriptorSet != nil {
+			descriptorSetFiles, err := invocation.descriptorSet.generatedFiles(request)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range descriptorSetFiles {
+				file.Name = prefix + file.Name
+				files = append(files, file)
+			}
+		}
+	}
+	return files, nil
+}
+
+// compile compiles the proto files of invocation with the Backend into the request protoc would send to plugins.
+func (thisP *Generator) compile(gen *generation, invocation *protocInvocation) (*pluginpb.CodeGeneratorRequest, error) {
+	protoDir := thisP.getProtoDirAbs(gen.genFilePkg.Dir)
+	if thisP.getBackend() == BackendGo {
+		request, err := thisP.compileGo(gen.ctx, invocation, protoDir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "compileGo() error")
+		}
+		return request, nil
+	}
+
+	// protoc writes a descriptor set, the plugins run directly on it
+	if len(invocation.extraArgs) > 0 {
+		return nil, fmt.Errorf("protoc options not supported by Generate, only --proto_path and --<plugin>_opt are: %v", invocation.extraArgs)
+	}
+	tmpDir, err := os.MkdirTemp("", "go-protoc-generate-")
+	if err != nil {
+		return nil, errors.Wrapf(err, "os.MkdirTemp() error")
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	descriptorSetFile := filepath.Join(tmpDir, "descriptor_set.binpb")
+	args := make([]string, 0, len(invocation.protoPaths)+len(invocation.protoFiles)+3)
+	for _, protoPath := range invocation.protoPaths {
+		args = append(args, "--proto_path="+protoPath)
+	}
+	args = append(args, "--descriptor_set_out="+descriptorSetFile, "--include_imports", "--include_source_info")
+	args = append(args, invocation.protoFiles...)
+	argsFile := filepath.Join(tmpDir, "args.txt")
+	if err = os.WriteFile(argsFile, []byte(strings.Join(args, "\n")+"\n"), 0666); err != nil {
+		return nil, errors.Wrapf(err, "os.WriteFile() error")
+	}
+	if err = thisP.runProtoc(gen, invocation, "@"+argsFile); err != nil {
+		return nil, err
+	}
+	descriptorSetBytes, err := os.ReadFile(descriptorSetFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "os.ReadFile() error")
+	}
+	descriptorSet := &descriptorpb.FileDescriptorSet{}
+	if err = proto.Unmarshal(descriptorSetBytes, descriptorSet); err != nil {
+		return nil, errors.Wrapf(err, "proto.Unmarshal() error")
+	}
+
+	request := &pluginpb.CodeGeneratorRequest{ProtoFile: descriptorSet.File, CompilerVersion: thisP.compilerVersion()}
+	for _, protoFile := range invocation.protoFiles {
+		fileName, err := relativeToProtoPath(invocation.protoPaths, protoFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "relativeToProtoPath() error")
+		}
+		request.FileToGenerate = append(request.FileToGenerate, fileName)
+	}
+	return request, nil
+}
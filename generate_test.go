@@ -0,0 +1,81 @@
+package goprotoc
+
+import (
+	"context"
+	"github.com/sky91/go-protoc/internal"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGenerateMatchesRun generates a module with Generate, then with Run, and compares the files.
+func TestGenerateMatchesRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("go installs protoc-gen-go")
+	}
+	// go list must not add modules to go.mod between Generate and Run
+	t.Setenv("GOFLAGS", "-mod=readonly")
+	goSum, err := os.ReadFile("go.sum")
+	if err != nil {
+		t.Fatalf("os.ReadFile() error: %v", err)
+	}
+	moduleDir := t.TempDir()
+	for file, content := range map[string]string{
+		"go.mod":   "module example.com/gentest\n\ngo 1.21\n\nrequire google.golang.org/protobuf v1.34.2\n",
+		"go.sum":   string(goSum),
+		"doc.go":   "package gentest\n",
+		"tools.go": "//go:build tools\n\npackage gentest\n\nimport _ \"google.golang.org/protobuf/cmd/protoc-gen-go\"\n",
+		"proto/gentest/v1/gentest.proto": "syntax = \"proto3\";\n\npackage gentest.v1;\n\n" +
+			"option go_package = \"example.com/gentest/proto_gen_go/gentest/v1;gentestv1\";\n\n" +
+			"// Greeting is a test message.\nmessage Greeting {\n  string text = 1;\n}\n",
+	} {
+		path := filepath.Join(moduleDir, filepath.FromSlash(file))
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("os.MkdirAll() error: %v", err)
+		}
+		if err = os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("os.WriteFile() error: %v", err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("os.Getwd() error: %v", err)
+	}
+	if err = os.Chdir(moduleDir); err != nil {
+		t.Fatalf("os.Chdir() error: %v", err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+
+	generator := &Generator{TargetDir: moduleDir, Backend: BackendGo, DisableJetBrains: true, Logger: internal.FuncLogger(t.Logf)}
+	defer func() {
+		manifestPath := generator.getGenerationManifestPath(&internal.PackagePublic{ImportPath: "example.com/gentest", Dir: moduleDir})
+		_ = os.RemoveAll(filepath.Dir(manifestPath))
+	}()
+	if err = generator.Init(); err != nil {
+		t.Fatalf("Init() error: %v", err)
+	}
+	files, err := generator.Generate(context.Background())
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("Generate() returned no files")
+	}
+	if err = generator.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	for _, file := range files {
+		written, err := os.ReadFile(filepath.Join(moduleDir, filepath.FromSlash(file.Name)))
+		if err != nil {
+			t.Errorf("file of Generate not written by Run: [%s], err=[%v]", file.Name, err)
+			continue
+		}
+		if string(written) != string(file.Content) {
+			t.Errorf("file differs from Run: [%s]\n%s", file.Name, internal.UnifiedDiff("run", "generate", string(written), string(file.Content)))
+		}
+		if strings.HasSuffix(file.Name, ".pb.go") && !strings.Contains(string(file.Content), "protoc        v5.27.2") {
+			t.Errorf("file header without the protoc version: [%s]", file.Name)
+		}
+	}
+}
@@ -36,13 +36,34 @@ type Generator struct {
 	ProtocDownloadUrl  string
 	ProtocVer          string
 	ProtocGenGoGrpcVer string
+	ProtocSHA256       map[string]string // OsArch -> hex sha256 of the protoc release zip
+	AllowUnpinned      bool              // run a protoc zip without a pinned sha256 instead of failing, only logging its sha256
+	ProtocLocalPath    string            // protoc release zip or extracted dir, used in offline mode
+	Offline            bool
+	LockTimeout        time.Duration // max wait for another process holding a cache entry lock
+	TargetDir          string        // dir of the package to generate for, instead of the go:generate GOFILE
+	TargetPackage      string        // import path or pattern of the package to generate for, instead of the go:generate GOFILE
 	CleanDir           string
-	CustomProtocOpts   []string
-	DisableJetBrains   bool
+	SafeClean          bool                // only remove files of CleanDir with a "Code generated ... DO NOT EDIT." header or generated by the last run
+	CustomProtocOpts   []string            // extra protoc args; --proto_path and --<plugin>_opt are merged with the ones Run emits, --<name>_out dirs are relative to the package dir and staged like ExtraOutputs
+	ExtraProtoPaths    []string            // extra proto paths, relative to the package dir
+	ExtraOutputs       map[string]string   // extra protoc output name -> out dir relative to the module dir, e.g. python -> gen/python
+	PluginParams       map[string][]string // plugin or extra output name -> extra --<name>_opt params
+	DisableJetBrains   bool                // skip the JetBrains integration, even if listed in IDEIntegrations
+	IDEIntegrations    []IDEIntegration    // IDEs to point at the proto paths, nil for JetBrains only
+	GoOptions          GoOptions           // options of the default go and go-grpc plugins
+	Plugins            []Plugin            // extra plugins, run after the default go and go-grpc plugins
+	DescriptorSet      DescriptorSet       // also write a FileDescriptorSet of the package, disabled if Out is empty
+	Backend            Backend
+	DiagnosticFormat   DiagnosticFormat
+	Check              bool // generate into a temp dir and fail if the result differs from CleanDir, without touching it
+	Incremental        bool // skip generation when protos, plugins and options are unchanged since the last run
+	Parallelism        int  // max packages RunModule generates at once, defaults to GOMAXPROCS
 	Logger             logger
 
 	getProtocDownloadUrl func() (string, error)
 	getProtocDistPath    func() (string, error)
+	shared               *sharedPreparation
 }
 
 func (thisP *Generator) Init() error {
@@ -55,84 +76,323 @@ func (thisP *Generator) Init() error {
 }
 
 func (thisP *Generator) Run(ctx context.Context) error {
-	genFilePkg, cmd, err := internal.GoListPkg(os.Getenv("GOFILE"), []string{"generate"})
+	gen, err := thisP.prepareGeneration(ctx)
 	if err != nil {
-		return errors.Wrapf(err, "GoListPkg() error: cmd=[%+v]", cmd)
+		return errors.Wrapf(err, "prepareGeneration() error")
 	}
-	if genFilePkg.Error != nil {
-		return fmt.Errorf("GoListPkg() error: cmd=[%+v], pbGoPkg.Error=[%+v]", cmd, genFilePkg.Error)
+	defer gen.close()
+	return thisP.runGeneration(gen)
+}
+
+func (thisP *Generator) runGeneration(gen *generation) (err error) {
+	genFilePkg, genPkg := gen.genFilePkg, gen.genPkg
+
+	// IDE integrations
+	if !thisP.Check {
+		ideDone := make(chan struct{})
+		go func() {
+			defer close(ideDone)
+			defer thisP.shared.lockIDE()()
+			thisP.configIDEs(gen)
+		}()
+		defer func() { <-ideDone }()
+	}
+
+	// proto gen file
+	protoGenFiles := make([]string, 0, len(gen.invocations))
+	for i, invocation := range gen.invocations {
+		protoGenFile := getProtoGenFilePathN(thisP.getProtoGenFilePath(genPkg), i)
+		if err = os.MkdirAll(filepath.Dir(protoGenFile), 0755); err != nil {
+			return errors.Wrapf(err, "os.MkdirAll() error")
+		}
+		if err = os.WriteFile(protoGenFile, invocation.argsFileBytes(), 0666); err != nil {
+			return errors.Wrapf(err, "os.WriteFile() error")
+		}
+		thisP.Logger.Infof("write proto gen file ok: [%s]", protoGenFile)
+		protoGenFiles = append(protoGenFiles, protoGenFile)
+	}
+
+	// incremental
+	cleanDirs := thisP.getCleanDirsAbs(genFilePkg.Dir)
+	var manifest *generationManifest
+	manifestPath := thisP.getGenerationManifestPath(genPkg)
+	prevManifest := readGenerationManifest(manifestPath)
+	if thisP.Incremental && !thisP.Check {
+		if manifest, err = thisP.buildGenerationManifest(gen.invocations); err != nil {
+			return errors.Wrapf(err, "buildGenerationManifest() error")
+		}
+		reason := manifest.staleReason(prevManifest)
+		if reason == "" {
+			thisP.Logger.Infof("skip generation, nothing changed since last run: manifest=[%s]", manifestPath)
+			return nil
+		}
+		thisP.Logger.Infof("generation needed: %s", reason)
+	} else if !thisP.Check {
+		// only the outputs, for SafeClean of the next run
+		manifest = &generationManifest{}
 	}
-	thisP.Logger.Infof("GoListPkg() ok: cmd=[%+v]", cmd)
 
-	genPkg, cmd, err := internal.GoListPkg(genFilePkg.Dir, []string{"generate"})
+	// clean dir, planned before generation and applied after it succeeded
+	cleanPaths, err := thisP.planClean(genFilePkg, genPkg, prevManifest)
 	if err != nil {
-		return errors.Wrapf(err, "GoListPkg() error: cmd=[%+v]", cmd)
+		return errors.Wrapf(err, "planClean() error")
+	}
+
+	// generate into the staging dirs
+	if !thisP.Check {
+		defer func() {
+			for _, invocation := range gen.invocations {
+				removeStagingDir(invocation.outDir)
+			}
+		}()
+	}
+	if err = createStagingDirs(gen.invocations); err != nil {
+		return errors.Wrapf(err, "createStagingDirs() error")
 	}
-	if genFilePkg.Error != nil {
-		return fmt.Errorf("GoListPkg() error: cmd=[%+v], pbGoPkg.Error=[%+v]", cmd, genFilePkg.Error)
+	for i, invocation := range gen.invocations {
+		if len(invocation.protoFiles) == 0 && len(gen.invocations) > 1 {
+			continue
+		}
+		if err = thisP.runInvocation(gen, invocation, protoGenFiles[i]); err != nil {
+			return err
+		}
 	}
-	thisP.Logger.Infof("GoListPkg() ok: cmd=[%+v]", cmd)
 
-	// protoc
-	if err = thisP.prepareProtoc(ctx); err != nil {
-		return errors.Wrapf(err, "prepareProtoc() error")
+	// swap the staged outputs into place
+	var kept map[string]string // files SafeClean kept, not outputs unless the generation changes them
+	if !thisP.Check {
+		if err = os.Remove(manifestPath); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "os.Remove() error")
+		}
+		if err = thisP.removeCleanPaths(cleanDirs, cleanPaths); err != nil {
+			return errors.Wrapf(err, "removeCleanPaths() error")
+		}
+		if kept, err = hashDirFiles(cleanDirs); err != nil {
+			return errors.Wrapf(err, "hashDirFiles() error")
+		}
+		for _, invocation := range gen.invocations {
+			if err = moveStagedFiles(invocation.outDir, invocation.moduleDir); err != nil {
+				return errors.Wrapf(err, "moveStagedFiles() error")
+			}
+		}
+		thisP.Logger.Infof("move staged files ok")
 	}
 
-	// protoc-gen-go
-	protocGenGoInstallDir, err := thisP.prepareProtocGenGo()
-	if err != nil {
-		return errors.Wrapf(err, "prepareProtocGenGo() error")
+	if manifest != nil {
+		if err = manifest.collectOutputs(cleanDirs, kept); err != nil {
+			return errors.Wrapf(err, "collectOutputs() error")
+		}
+		if err = manifest.save(manifestPath); err != nil {
+			return errors.Wrapf(err, "save() error")
+		}
 	}
 
-	// protoc-gen-go-grpc
-	protocGenGoGrpcInstallDir, err := thisP.prepareProtocGenGoGrpc()
+	if thisP.Check {
+		outOfDate := &OutOfDateError{Diffs: map[string]string{}}
+		for i, invocation := range gen.invocations {
+			invocationCleanDirs, invocationCleanPaths := cleanDirs, cleanPaths
+			if i > 0 {
+				// the CleanDir dirs of a go.work module are at the same place relative to its module dir
+				if invocationCleanDirs, err = moveDirsToModule(getModuleDir(genPkg), invocation.moduleDir, cleanDirs); err != nil {
+					return errors.Wrapf(err, "moveDirsToModule() error")
+				}
+				if invocationCleanPaths, err = thisP.planCleanDirs(invocationCleanDirs, prevManifest); err != nil {
+					return errors.Wrapf(err, "planCleanDirs() error")
+				}
+			}
+			committed, err := thisP.listCommitted(invocation.moduleDir, invocationCleanDirs, invocationCleanPaths)
+			if err != nil {
+				return errors.Wrapf(err, "listCommitted() error")
+			}
+			err = compareGenerated(invocation.moduleDir, invocation.outDir, committed)
+			if invocationOutOfDate := (*OutOfDateError)(nil); errors.As(err, &invocationOutOfDate) {
+				outOfDate.merge(invocationOutOfDate, relSlashPrefix(genPkg.Module.Dir, invocation.moduleDir))
+			} else if err != nil {
+				return err
+			}
+		}
+		if !outOfDate.empty() {
+			return outOfDate
+		}
+		thisP.Logger.Infof("check ok, generated code is up to date")
+	}
+	return nil
+}
+
+// runInvocation runs one protoc invocation of gen with the Backend.
+func (thisP *Generator) runInvocation(gen *generation, invocation *protocInvocation, protoGenFile string) error {
+	protoDir := thisP.getProtoDirAbs(gen.genFilePkg.Dir)
+	if thisP.getBackend() == BackendGo {
+		if err := thisP.runGoBackend(gen.ctx, invocation, protoDir); err != nil {
+			return errors.Wrapf(err, "runGoBackend() error")
+		}
+	} else if err := thisP.runProtoc(gen, invocation, "@"+protoGenFile); err != nil {
+		return err
+	}
+	if invocation.descriptorSet != nil && invocation.descriptorSet.GoFile != "" {
+		if err := invocation.descriptorSet.writeGoFile(invocation.outDir); err != nil {
+			return errors.Wrapf(err, "writeGoFile() error")
+		}
+	}
+	return nil
+}
+
+// runProtoc runs protoc with args, reporting its diagnostics for the proto paths of invocation.
+func (thisP *Generator) runProtoc(gen *generation, invocation *protocInvocation, args ...string) error {
+	protoDir := thisP.getProtoDirAbs(gen.genFilePkg.Dir)
+	stderr := bytes.Buffer{}
+	cmd := exec.CommandContext(gen.ctx, getProtocBinPath(gen.protocDistPath), args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = &stderr
+	if thisP.DiagnosticFormat == DiagnosticFormatRaw {
+		cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	}
+	cmd.Env = os.Environ()
+	thisP.Logger.Infof("cmd begin: cmd=[%+v]", cmd)
+	err := cmd.Run()
+	diagnostics := parseProtocDiagnostics(stderr.String(), invocation.protoPaths, protoDir)
+	thisP.printDiagnostics(diagnostics)
 	if err != nil {
-		return errors.Wrapf(err, "prepareProtocGenGoGrpc() error")
+		return &ProtocError{Diagnostics: diagnostics, Err: errors.Wrapf(err, "cmd.Run() error: cmd=[%+v]", cmd)}
 	}
+	thisP.Logger.Infof("cmd ok: cmd=[%+v]", cmd)
+	return nil
+}
 
-	protocOpts := bytes.Buffer{}
+// RunForPackage is Run for the package matched by pkgPattern, ignoring TargetDir, TargetPackage and GOFILE.
+func (thisP *Generator) RunForPackage(ctx context.Context, pkgPattern string) error {
+	generator := *thisP
+	generator.TargetDir, generator.TargetPackage = "", pkgPattern
+	return generator.Run(ctx)
+}
 
-	// proto_path
-	protoPaths, err := listImportPathDir(genFilePkg.Imports)
+// ProtocArgs prepares protoc and plugins like Run and returns the protoc arguments Run would write to its argument files,
+// one per protoc run: the first for the module of the package, then one per go.work module owning a go_package.
+func (thisP *Generator) ProtocArgs(ctx context.Context) ([][]string, error) {
+	gen, err := thisP.prepareGeneration(ctx)
 	if err != nil {
-		return errors.Wrapf(err, "listImportPathDir() error")
+		return nil, errors.Wrapf(err, "prepareGeneration() error")
 	}
-	protocDistPath, err := thisP.getProtocDistPath()
+	defer gen.close()
+	args := make([][]string, 0, len(gen.invocations))
+	for _, invocation := range gen.invocations {
+		args = append(args, invocation.args())
+	}
+	return args, nil
+}
+
+// Clean removes the CleanDir dirs of the package, or with SafeClean only the generated files in them, without generating anything.
+func (thisP *Generator) Clean(ctx context.Context) error {
+	genFilePkg, genPkg, err := thisP.resolvePackages()
 	if err != nil {
-		return errors.Wrapf(err, "getProtocDistPath() error")
+		return errors.Wrapf(err, "resolvePackages() error")
+	}
+	manifestPath := thisP.getGenerationManifestPath(genPkg)
+	cleanPaths, err := thisP.planClean(genFilePkg, genPkg, readGenerationManifest(manifestPath))
+	if err != nil {
+		return errors.Wrapf(err, "planClean() error")
+	}
+	if err = thisP.removeCleanPaths(thisP.getCleanDirsAbs(genFilePkg.Dir), cleanPaths); err != nil {
+		return errors.Wrapf(err, "removeCleanPaths() error")
+	}
+	if err = os.Remove(manifestPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "os.Remove() error")
+	}
+	return nil
+}
+
+// InstallPlugins installs the enabled plugins into the cache and returns their binaries.
+// Devel builds, from a replaced or the main module, are not cached: they are left in temp dirs for the caller to remove.
+func (thisP *Generator) InstallPlugins(ctx context.Context) ([]string, error) {
+	plugins, err := thisP.preparePlugins(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "preparePlugins() error")
+	}
+	binaries := make([]string, 0, len(plugins))
+	for _, plugin := range plugins {
+		binaries = append(binaries, plugin.path)
+	}
+	return binaries, nil
+}
+
+// generation is the prepared state of a Run.
+type generation struct {
+	ctx              context.Context
+	genFilePkg       *internal.PackagePublic
+	genPkg           *internal.PackagePublic
+	protocDistPath   string
+	importProtoPaths []string            // dirs of the imported packages, sorted
+	importPkgDirs    map[string]string   // importProtoPaths -> Go import path
+	invocations      []*protocInvocation // the first outputs to the module of genPkg
+
+	cleanups []func()
+}
+
+func (thisP *generation) close() {
+	for i := len(thisP.cleanups) - 1; i >= 0; i-- {
+		thisP.cleanups[i]()
+	}
+}
+
+func (thisP *Generator) prepareGeneration(ctx context.Context) (*generation, error) {
+	if err := thisP.Backend.validate(); err != nil {
+		return nil, err
 	}
-	for _, protoPath := range append(protoPaths, thisP.getProtoDirAbs(genFilePkg.Dir), filepath.Join(protocDistPath, "include")) {
-		_, _ = protocOpts.WriteString(fmt.Sprintf("--proto_path=%s\n", protoPath))
+	genFilePkg, genPkg, err := thisP.resolvePackages()
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolvePackages() error")
 	}
+	return thisP.preparePackageGeneration(ctx, genFilePkg, genPkg, nil)
+}
 
-	// JetBrains plugin ProtoEditor
-	protoEditorGroup := errgroup.Group{}
-	protoEditorGroup.Go(func() error { return configProtoEditor(genPkg, protoPaths) })
+// preparePackageGeneration prepares a Run for resolved packages, importPkgDirs is listed from genFilePkg if nil.
+func (thisP *Generator) preparePackageGeneration(ctx context.Context, genFilePkg, genPkg *internal.PackagePublic, importPkgDirs map[string]string) (_ *generation, err error) {
+	gen := &generation{ctx: ctx, genFilePkg: genFilePkg, genPkg: genPkg, importPkgDirs: importPkgDirs}
 	defer func() {
-		if err := protoEditorGroup.Wait(); err != nil {
-			thisP.Logger.Errorf("configProtoEditor error: %+v", err)
+		if err != nil {
+			gen.close()
 		}
 	}()
-	thisP.Logger.Infof("ProtoEditor config ok")
 
-	// protoc go
-	goExe, err := internal.GoEnv("GOEXE")
-	if err != nil {
-		return errors.Wrapf(err, "GoEnv() error")
+	// protoc
+	if thisP.getBackend() == BackendProtoc {
+		if thisP.shared == nil {
+			if err = thisP.prepareProtoc(ctx); err != nil {
+				return nil, errors.Wrapf(err, "prepareProtoc() error")
+			}
+		}
+		if gen.protocDistPath, err = thisP.getProtocDistPath(); err != nil {
+			return nil, errors.Wrapf(err, "getProtocDistPath() error")
+		}
 	}
-	_, _ = protocOpts.WriteString(fmt.Sprintf("--go_out=%s\n", genPkg.Module.Dir))
-	_, _ = protocOpts.WriteString(fmt.Sprintf("--go_opt=module=%s\n", genPkg.Module.Path))
-	_, _ = protocOpts.WriteString(fmt.Sprintf("--plugin=protoc-gen-go=%s\n", filepath.Join(protocGenGoInstallDir, "protoc-gen-go"+goExe)))
 
-	// protoc go grpc
-	if protocGenGoGrpcInstallDir != "" {
-		_, _ = protocOpts.WriteString(fmt.Sprintf("--go-grpc_out=%s\n", genPkg.Module.Dir))
-		_, _ = protocOpts.WriteString(fmt.Sprintf("--go-grpc_opt=module=%s\n", genPkg.Module.Path))
-		_, _ = protocOpts.WriteString(fmt.Sprintf("--plugin=protoc-gen-go-grpc=%s\n", filepath.Join(protocGenGoGrpcInstallDir, "protoc-gen-go-grpc"+goExe)))
+	// proto_path
+	if gen.importPkgDirs == nil {
+		if gen.importPkgDirs, err = listImportPathDir(gen.genFilePkg.Imports); err != nil {
+			return nil, errors.Wrapf(err, "listImportPathDir() error")
+		}
+	}
+	gen.importProtoPaths = sortedKeys(gen.importPkgDirs)
+	protoPaths := append(append([]string{}, gen.importProtoPaths...), thisP.getProtoDirAbs(gen.genFilePkg.Dir))
+	if gen.protocDistPath != "" {
+		protoPaths = append(protoPaths, filepath.Join(gen.protocDistPath, "include"))
+	}
+	custom, err := thisP.parseCustomProtocOpts(gen.genFilePkg.Dir, gen.genPkg.Module.Dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parseCustomProtocOpts() error")
+	}
+	protoPaths = append(protoPaths, thisP.getExtraProtoPaths(gen.genFilePkg.Dir, custom)...)
+	workspaceMods, err := listWorkspaceModules()
+	if err != nil {
+		return nil, errors.Wrapf(err, "listWorkspaceModules() error")
+	}
+	if protoPaths, err = appendWorkspaceProtoPaths(protoPaths, workspaceMods); err != nil {
+		return nil, errors.Wrapf(err, "appendWorkspaceProtoPaths() error")
 	}
 
 	// proto file
-	if err = filepath.WalkDir(thisP.getProtoDirAbs(genFilePkg.Dir), func(path string, d fs.DirEntry, err error) error {
+	var protoFiles []string
+	if err = filepath.WalkDir(thisP.getProtoDirAbs(gen.genFilePkg.Dir), func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return errors.Wrap(err, "WalkDirFunc error")
 		}
@@ -143,49 +403,82 @@ func (thisP *Generator) Run(ctx context.Context) error {
 		if err != nil {
 			return fmt.Errorf("filepath.Abs() error: [%w]", err)
 		}
-		_, _ = protocOpts.WriteString(absPath + "\n")
+		protoFiles = append(protoFiles, absPath)
 		return nil
 	}); err != nil {
-		return errors.Wrapf(err, "filepath.WalkDir() error")
+		return nil, errors.Wrapf(err, "filepath.WalkDir() error")
 	}
 
-	// proto gen file
-	protoGenFile := thisP.getProtoGenFilePath(genPkg)
-	if err = os.MkdirAll(filepath.Dir(protoGenFile), 0755); err != nil {
-		return errors.Wrapf(err, "os.MkdirAll() error")
+	// proto_path of the module dependencies shipping imported files
+	modProtoPaths, err := thisP.discoverModuleProtoPaths(protoPaths, protoFiles)
+	if err != nil {
+		return nil, errors.Wrapf(err, "discoverModuleProtoPaths() error")
 	}
-	if err = os.WriteFile(protoGenFile, protocOpts.Bytes(), 0666); err != nil {
-		return errors.Wrapf(err, "os.WriteFile() error")
+	goPkgDirs := make(map[string]string, len(gen.importPkgDirs)+len(modProtoPaths))
+	for dir, importPath := range gen.importPkgDirs {
+		goPkgDirs[dir] = importPath
+	}
+	for _, modProtoPath := range modProtoPaths {
+		protoPaths = append(protoPaths, modProtoPath.dir)
+		goPkgDirs[modProtoPath.dir] = modProtoPath.modulePath
 	}
-	thisP.Logger.Infof("write proto gen file ok: [%s]", protoGenFile)
 
-	// clean dir
-	for _, dir := range strings.Split(thisP.getCleanDir(), ",") {
-		dir = strings.TrimSpace(dir)
-		if dir == "" {
-			continue
+	// plugins, one invocation per module owning generated files
+	plugins, err := thisP.preparePlugins(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "preparePlugins() error")
+	}
+	for _, plugin := range plugins {
+		if plugin.temporary {
+			installDir := filepath.Dir(plugin.path)
+			gen.cleanups = append(gen.cleanups, func() { _ = os.RemoveAll(installDir) })
 		}
-		if !filepath.IsAbs(dir) {
-			dir = filepath.Join(genFilePkg.Dir, dir)
+	}
+	groups, err := groupProtoFilesByModule(protoFiles, gen.genPkg.Module, workspaceMods)
+	if err != nil {
+		return nil, errors.Wrapf(err, "groupProtoFilesByModule() error")
+	}
+	goMappings, err := thisP.inferGoMappings(protoPaths, protoFiles, goPkgDirs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "inferGoMappings() error")
+	}
+	if thisP.DescriptorSet.Out != "" {
+		if err = thisP.DescriptorSet.validate(); err != nil {
+			return nil, errors.Wrapf(err, "DescriptorSet.validate() error")
 		}
-
-		thisP.Logger.Infof("clean dir: [%s]", dir)
-		if err = os.RemoveAll(dir); err != nil {
-			return errors.Wrapf(err, "os.RemoveAll() error")
+	}
+	for i, group := range groups {
+		invocation := &protocInvocation{protoPaths: protoPaths, protoFiles: group.protoFiles, moduleDir: group.module.Dir,
+			outDir: getStagingDir(group.module.Dir, gen.genPkg)}
+		if thisP.Check {
+			if invocation.outDir, err = os.MkdirTemp("", "go-protoc-check-"); err != nil {
+				return nil, errors.Wrapf(err, "os.MkdirTemp() error")
+			}
+			tmpDir := invocation.outDir
+			gen.cleanups = append(gen.cleanups, func() { _ = os.RemoveAll(tmpDir) })
+			thisP.Logger.Infof("check mode, generate into: [%s]", invocation.outDir)
+		}
+		if group.module.Path != gen.genPkg.Module.Path {
+			thisP.Logger.Infof("go.work module [%s] owns files: %v", group.module.Path, group.protoFiles)
+		}
+		if i == 0 && thisP.DescriptorSet.Out != "" {
+			if invocation.descriptorSet, err = thisP.DescriptorSet.inModule(group.module.Dir, gen.genFilePkg); err != nil {
+				return nil, errors.Wrapf(err, "DescriptorSet.inModule() error")
+			}
 		}
+		if invocation.plugins, err = newPluginInvocations(plugins, group.module.Path, invocation.moduleDir, invocation.outDir); err != nil {
+			return nil, errors.Wrapf(err, "newPluginInvocations() error")
+		}
+		if err = thisP.applyExtraOpts(invocation, custom); err != nil {
+			return nil, errors.Wrapf(err, "applyExtraOpts() error")
+		}
+		applyGoMappings(invocation, goMappings)
+		gen.invocations = append(gen.invocations, invocation)
 	}
-
-	cmd = exec.Command(filepath.Join(protocDistPath, "bin", "protoc"), "@"+protoGenFile)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Env = os.Environ()
-	thisP.Logger.Infof("cmd begin: cmd=[%+v]", cmd)
-	if err = cmd.Run(); err != nil {
-		return errors.Wrapf(err, "cmd.Run() error: cmd=[%+v]", cmd)
-	} else {
-		thisP.Logger.Infof("cmd ok: cmd=[%+v]", cmd)
+	if err = thisP.checkGoPackages(gen, groups); err != nil {
+		return nil, err
 	}
-	return nil
+	return gen, nil
 }
 
 func (thisP *Generator) prepareProtoc(ctx context.Context) error {
@@ -198,8 +491,25 @@ func (thisP *Generator) prepareProtoc(ctx context.Context) error {
 	}
 	thisP.Logger.Infof("protocDistZipFilepath: [%s]", protocDistZipFilepath)
 
-	zipFileBytes, err := os.ReadFile(protocDistZipFilepath)
-	if err == nil && len(zipFileBytes) < 1024*1024 ||
+	unlock, err := thisP.lockCacheEntry(ctx, protocDistZipFilepath)
+	if err != nil {
+		return errors.Wrapf(err, "lockCacheEntry() error")
+	}
+	defer unlock()
+
+	var zipFileBytes []byte
+	if thisP.isOffline() {
+		cacheZipFilepath := protocDistZipFilepath
+		if protocDistZipFilepath, zipFileBytes, err = thisP.readProtocZipOffline(cacheZipFilepath); err != nil {
+			return errors.Wrapf(err, "readProtocZipOffline() error")
+		}
+		if zipFileBytes == nil {
+			return nil
+		}
+		if protocDistZipFilepath != cacheZipFilepath {
+			thisP.Logger.Infof("offline mode, use protoc zip: [%s]", protocDistZipFilepath)
+		}
+	} else if zipFileBytes, err = os.ReadFile(protocDistZipFilepath); err == nil && len(zipFileBytes) < 1024*1024 ||
 		err != nil && os.IsNotExist(err) {
 		downloadUrl, err := thisP.getProtocDownloadUrl()
 		if err != nil {
@@ -218,6 +528,28 @@ func (thisP *Generator) prepareProtoc(ctx context.Context) error {
 		return errors.Wrapf(err, "os.ReadFile() error")
 	}
 
+	zipFileSHA256 := sha256Hex(zipFileBytes)
+	if err = thisP.verifyProtocZip(protocDistZipFilepath, zipFileSHA256); err != nil {
+		if _, ok := err.(*ChecksumMissingError); ok {
+			// the zip may still be pinned later, only a mismatch poisons the cache
+			return errors.Wrapf(err, "verifyProtocZip() error")
+		}
+		protocDistPath, pathErr := thisP.getProtocDistPath()
+		if pathErr != nil {
+			return errors.Wrapf(pathErr, "getProtocDistPath() error")
+		}
+		poisonedPaths := []string{protocDistPath, getProtocDistManifestPath(protocDistPath)}
+		if cacheZipFilepath, pathErr := thisP.getProtocDistZipFilePath(); pathErr == nil && cacheZipFilepath == protocDistZipFilepath {
+			poisonedPaths = append(poisonedPaths, protocDistZipFilepath)
+		}
+		for _, poisoned := range poisonedPaths {
+			if rmErr := os.RemoveAll(poisoned); rmErr != nil {
+				thisP.Logger.Errorf("os.RemoveAll() error: path=[%s], err=[%+v]", poisoned, rmErr)
+			}
+		}
+		return errors.Wrapf(err, "verifyProtocZip() error")
+	}
+
 	zipReader, err := zip.NewReader(bytes.NewReader(zipFileBytes), int64(len(zipFileBytes)))
 	if err != nil {
 		return errors.Wrapf(err, "zip.NewReader() error")
@@ -226,57 +558,36 @@ func (thisP *Generator) prepareProtoc(ctx context.Context) error {
 	if err != nil {
 		return errors.Wrapf(err, "getProtocDistPath() error")
 	}
-	if err = os.RemoveAll(protocDistPath); err != nil {
-		return errors.Wrapf(err, "os.RemoveAll() error")
+	if thisP.isProtocDistIntact(protocDistPath, zipFileSHA256) {
+		thisP.Logger.Infof("protoc dist intact, skip unzip: [%s]", protocDistPath)
+		return nil
 	}
-	if err = internal.Unzip(zipReader, protocDistPath); err != nil {
-		return fmt.Errorf("unzip() error: [%w]", err)
+	if err = thisP.extractProtocDist(zipReader, zipFileSHA256, protocDistPath); err != nil {
+		return errors.Wrapf(err, "extractProtocDist() error")
 	}
 	thisP.Logger.Infof("unzip() ok: [%s]", protocDistPath)
 	return nil
 }
 
-func (thisP *Generator) prepareProtocGenGo() (installDir string, err error) {
-	ProtocGenGoPkg, cmd, err := internal.GoListPkg(pkgNameProtocGenGo, nil)
-	if err != nil {
-		return "", errors.Wrapf(err, "GoListPkg() error: cmd=[%+v]", cmd)
-	}
-	if ProtocGenGoPkg.Error != nil {
-		return "", fmt.Errorf("GoListPkg() error: cmd=[%+v], err=[%+v]", cmd, ProtocGenGoPkg.Error)
-	}
-	thisP.Logger.Infof("GoListPkg() ok: cmd=[%+v]", cmd)
-	thisP.Logger.Infof("pkg found: [%s@%s]", pkgNameProtocGenGo, ProtocGenGoPkg.Module.Version)
-
-	installDir = thisP.getProtocGenGoPath(ProtocGenGoPkg.Module.Version)
-	if err = os.MkdirAll(installDir, 0755); err != nil {
-		return "", errors.Wrap(err, "os.MkdirAll() error")
-	}
-	if cmd, err = internal.GoInstall(pkgNameProtocGenGo, installDir); err != nil {
-		return "", errors.Wrapf(err, "GoInstall() error: cmd=[%+v]", cmd)
+func (thisP *Generator) goInstall(ctx context.Context, pkg, modWithVer, installDir string) error {
+	if err := os.MkdirAll(installDir, 0755); err != nil {
+		return errors.Wrapf(err, "os.MkdirAll() error")
 	}
-	thisP.Logger.Infof("GoInstall() ok: cmd=[%+v], dest=[%s]", cmd, installDir)
-	return installDir, nil
-}
-
-func (thisP *Generator) prepareProtocGenGoGrpc() (installDir string, err error) {
-	grpcPkg, cmd, err := internal.GoListPkg(pkgNameGrpc, nil)
+	unlock, err := thisP.lockCacheEntry(ctx, installDir)
 	if err != nil {
-		return "", errors.Wrapf(err, "GoListPkg() error: cmd=[%+v]", cmd)
+		return errors.Wrapf(err, "lockCacheEntry() error")
 	}
-	if grpcPkg.Error != nil {
-		thisP.Logger.Infof("pkg [%s] not found, will not generate grpc, cmd=[%+v]", pkgNameGrpc, cmd)
-		return "", nil
-	}
-	thisP.Logger.Infof("pkg found: [%s@%s]", pkgNameGrpc, grpcPkg.Module.Version)
-	installDir = thisP.getProtocGenGoGrpcPath(thisP.getProtocGenGoGrpcVer())
-	if err = os.MkdirAll(installDir, 0755); err != nil {
-		return "", errors.Wrapf(err, "os.MkdirAll() error")
-	}
-	if cmd, err = internal.GoInstall(pkgNameProtocGenGoGrpc+"@v"+thisP.getProtocGenGoGrpcVer(), installDir); err != nil {
-		return "", fmt.Errorf("GoInstall() error: cmd=[%+v], err=[%w]", cmd, err)
+	defer unlock()
+	cmd, err := internal.GoInstall(pkg, installDir, thisP.getGoCmdEnv()...)
+	if err != nil {
+		if thisP.isOffline() {
+			return fmt.Errorf("offline mode, [%s] is missing from the module cache, run `go mod download %s` while online: cmd=[%+v], err=[%w]",
+				modWithVer, modWithVer, cmd, err)
+		}
+		return errors.Wrapf(err, "GoInstall() error: cmd=[%+v]", cmd)
 	}
 	thisP.Logger.Infof("GoInstall() ok: cmd=[%+v], dest=[%s]", cmd, installDir)
-	return installDir, nil
+	return nil
 }
 
 func (thisP *Generator) doGetProtocDownloadUrl() (string, error) {
@@ -289,6 +600,10 @@ func (thisP *Generator) doGetProtocDownloadUrl() (string, error) {
 		return "", errors.Wrapf(err, "template.New().Parse() error")
 	}
 
+	osArch, err := protocOsArch()
+	if err != nil {
+		return "", errors.Wrapf(err, "getProtocOsArch() error")
+	}
 	var buf bytes.Buffer
 	if err = tmpl.Execute(&buf, struct {
 		Version string
@@ -300,6 +615,15 @@ func (thisP *Generator) doGetProtocDownloadUrl() (string, error) {
 }
 
 func (thisP *Generator) doGetProtocDistPath() (string, error) {
+	if localDir, ok, err := thisP.getProtocLocalDir(); err != nil {
+		return "", errors.Wrapf(err, "getProtocLocalDir() error")
+	} else if ok {
+		return localDir, nil
+	}
+	return thisP.getProtocCachePath()
+}
+
+func (thisP *Generator) getProtocCachePath() (string, error) {
 	downloadUrl, err := thisP.getProtocDownloadUrl()
 	if err != nil {
 		return "", errors.Wrapf(err, "getProtocDownloadUrl() error")
@@ -310,11 +634,11 @@ func (thisP *Generator) doGetProtocDistPath() (string, error) {
 }
 
 func (thisP *Generator) getProtocDistZipFilePath() (string, error) {
-	distPath, err := thisP.getProtocDistPath()
+	cachePath, err := thisP.getProtocCachePath()
 	if err != nil {
-		return "", errors.Wrapf(err, "getProtocDistPath() error")
+		return "", errors.Wrapf(err, "getProtocCachePath() error")
 	}
-	return distPath + ".zip", nil
+	return cachePath + ".zip", nil
 }
 
 func (thisP *Generator) getProtocVer() string {
@@ -324,19 +648,11 @@ func (thisP *Generator) getProtocVer() string {
 	return defaultProtocVer
 }
 
-func (thisP *Generator) getProtocGenGoGrpcVer() string {
-	if thisP.ProtocGenGoGrpcVer != "" {
-		return thisP.ProtocGenGoGrpcVer
+func (thisP *Generator) getBackend() Backend {
+	if thisP.Backend != "" {
+		return thisP.Backend
 	}
-	return defaultProtocGenGoGrpcVer
-}
-
-func (thisP *Generator) getProtocGenGoPath(protocGenGoVer string) string {
-	return filepath.Join(protocGenGoDir, protocGenGoVer)
-}
-
-func (thisP *Generator) getProtocGenGoGrpcPath(protocGenGoGrpcVer string) string {
-	return filepath.Join(protocGenGoGrpcDir, protocGenGoGrpcVer)
+	return BackendProtoc
 }
 
 func (thisP *Generator) getProtoDir() string {
@@ -358,6 +674,14 @@ func (thisP *Generator) getProtoGenFilePath(genPkg *internal.PackagePublic) stri
 	return filepath.Join(os.TempDir(), ".go-protoc", regexp.MustCompile(`\W+`).ReplaceAllString(genPkg.ImportPath, "_"), "proto_gen.txt")
 }
 
+// getProtoGenFilePathN is the proto gen file of the i-th protoc invocation of a Run.
+func getProtoGenFilePathN(protoGenFile string, i int) string {
+	if i == 0 {
+		return protoGenFile
+	}
+	return strings.TrimSuffix(protoGenFile, ".txt") + fmt.Sprintf(".%d.txt", i)
+}
+
 func (thisP *Generator) getCleanDir() string {
 	if thisP.CleanDir != "" {
 		return thisP.CleanDir
@@ -365,6 +689,29 @@ func (thisP *Generator) getCleanDir() string {
 	return defaultCleanDir
 }
 
+func (thisP *Generator) getCleanDirsAbs(current string) []string {
+	var dirs []string
+	for _, dir := range strings.Split(thisP.getCleanDir(), ",") {
+		dir = strings.TrimSpace(dir)
+		if dir == "" {
+			continue
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(current, dir)
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+func getProtocBinPath(protocDistPath string) string {
+	protocBin := filepath.Join(protocDistPath, "bin", "protoc")
+	if runtime.GOOS == "windows" {
+		protocBin += ".exe"
+	}
+	return protocBin
+}
+
 func getProtocOsArch() (string, error) {
 	goos, ok := os.LookupEnv("GOOS")
 	if !ok {
@@ -468,8 +815,9 @@ func getProtocFileName(ver string) string {
 	panic(fmt.Sprintf("not support os:[%s] and arch:[%s]", goos, goarch))
 }
 
-func listImportPathDir(importPaths []string) ([]string, error) {
-	dirs := make([]string, 0, len(importPaths))
+// listImportPathDir returns the dirs of the imported packages, used as proto paths, mapped to their import paths.
+func listImportPathDir(importPaths []string) (map[string]string, error) {
+	dirs := make(map[string]string, len(importPaths))
 	mtx := sync.Mutex{}
 	group := errgroup.Group{}
 	for _, importPath := range importPaths {
@@ -489,7 +837,7 @@ func listImportPathDir(importPaths []string) ([]string, error) {
 				return fmt.Errorf("GoListPkg() error, cannot find pkg dir: cmd=[%+v]", cmd)
 			}
 			mtx.Lock()
-			dirs = append(dirs, importPkgInfo.Dir)
+			dirs[importPkgInfo.Dir] = importPkgInfo.ImportPath
 			mtx.Unlock()
 			return nil
 		})
@@ -500,24 +848,12 @@ func listImportPathDir(importPaths []string) ([]string, error) {
 	return dirs, nil
 }
 
-func configProtoEditor(genPkg *internal.PackagePublic, protoPaths []string) error {
-	protoEditor, err := internal.FindJetBrainsRootAndOpen(genPkg.Dir)
-	if err != nil {
-		return nil
-	}
-	protoEditor.ConfigProtoPath(genPkg.ImportPath, protoPaths)
-	if err = protoEditor.Save(); err != nil {
-		return fmt.Errorf("func protoEditor.Save() error: [%w]", err)
-	}
-	return nil
-}
-
 const (
-	defaultProtocDownloadUrl  = `https://github.com/protocolbuffers/protobuf/releases/download/v{{.Version}}/protoc-{{.Version}}-{{.OsArch}}.zip`
-	defaultProtocVer          = "27.2"
-	defaultProtocGenGoGrpcVer = "1.4.0"
-	defaultProtoDir           = "proto"
-	defaultCleanDir           = "proto_gen_go"
+	defaultProtocDownloadUrl = `https://github.com/protocolbuffers/protobuf/releases/download/v{{.Version}}/protoc-{{.Version}}-{{.OsArch}}.zip`
+	defaultProtocVer         = "27.2"
+	defaultProtoDir          = "proto"
+	defaultCleanDir          = "proto_gen_go"
+	defaultLockTimeout       = 5 * time.Minute
 
 	pkgNameProtocGenGo     = "google.golang.org/protobuf/cmd/protoc-gen-go"
 	pkgNameGrpc            = "google.golang.org/grpc"
@@ -525,9 +861,8 @@ const (
 )
 
 var (
-	osArch             = lo.Must(getProtocOsArch())
-	rootDir            = filepath.Join(lo.Must(os.UserCacheDir()), ".go_protoc")
-	protocDistDir      = filepath.Join(rootDir, "protoc")
-	protocGenGoDir     = filepath.Join(rootDir, "protoc-gen-go")
-	protocGenGoGrpcDir = filepath.Join(rootDir, "protoc-gen-go-grpc")
+	protocOsArch  = sync.OnceValues(getProtocOsArch)
+	rootDir       = filepath.Join(lo.Must(os.UserCacheDir()), ".go_protoc")
+	protocDistDir = filepath.Join(rootDir, "protoc")
+	manifestDir   = filepath.Join(rootDir, "manifest")
 )
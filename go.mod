@@ -3,9 +3,12 @@ module github.com/sky91/go-protoc
 go 1.21
 
 require (
+	github.com/bufbuild/protocompile v0.14.1
 	github.com/pkg/errors v0.9.1
 	github.com/samber/lo v1.44.0
-	golang.org/x/sync v0.7.0
+	golang.org/x/sync v0.8.0
+	google.golang.org/protobuf v1.34.2
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require golang.org/x/text v0.16.0 // indirect
@@ -0,0 +1,233 @@
+package goprotoc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/bufbuild/protocompile"
+	"github.com/bufbuild/protocompile/linker"
+	"github.com/bufbuild/protocompile/reporter"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Backend selects how .proto files are compiled.
+type Backend string
+
+const (
+	// BackendProtoc downloads a native protoc and runs it.
+	BackendProtoc Backend = "protoc"
+	// BackendGo parses and links .proto files in-process and drives the plugins like protoc does.
+	BackendGo Backend = "go"
+)
+
+func (thisV Backend) validate() error {
+	switch thisV {
+	case "", BackendProtoc, BackendGo:
+		return nil
+	}
+	return fmt.Errorf("unknown Backend: [%s], expect %s or %s", thisV, BackendProtoc, BackendGo)
+}
+
+// compilerVersion is the version protoc of ProtocVer reports to plugins, nil if ProtocVer is not a release version.
+// Releases since 22.x carry the C++ library major in front: 22.x to 25.x are 4.x, 26.x to 29.x are 5.x, then 6.x.
+func (thisP *Generator) compilerVersion() *pluginpb.Version {
+	version, suffix, _ := strings.Cut(thisP.getProtocVer(), "-")
+	parts := strings.Split(version, ".")
+	numbers := make([]int32, 0, 3)
+	for _, part := range parts {
+		number, err := strconv.ParseInt(part, 10, 32)
+		if err != nil {
+			return nil
+		}
+		numbers = append(numbers, int32(number))
+	}
+	switch {
+	case len(numbers) == 3:
+	case len(numbers) != 2:
+		return nil
+	case numbers[0] >= 30:
+		numbers = append([]int32{6}, numbers...)
+	case numbers[0] >= 26:
+		numbers = append([]int32{5}, numbers...)
+	case numbers[0] >= 22:
+		numbers = append([]int32{4}, numbers...)
+	default:
+		numbers = append([]int32{3}, numbers...)
+	}
+	compilerVersion := &pluginpb.Version{Major: proto.Int32(numbers[0]), Minor: proto.Int32(numbers[1]), Patch: proto.Int32(numbers[2])}
+	if suffix != "" {
+		compilerVersion.Suffix = proto.String(suffix)
+	}
+	return compilerVersion
+}
+
+func (thisP *Generator) runGoBackend(ctx context.Context, invocation *protocInvocation, protoDir string) error {
+	request, err := thisP.compileGo(ctx, invocation, protoDir)
+	if err != nil {
+		return err
+	}
+	if invocation.descriptorSet != nil {
+		setBytes, err := invocation.descriptorSet.build(request)
+		if err != nil {
+			return errors.Wrapf(err, "build() error")
+		}
+		if err = os.WriteFile(filepath.Join(invocation.outDir, filepath.FromSlash(invocation.descriptorSet.Out)), setBytes, 0666); err != nil {
+			return errors.Wrapf(err, "os.WriteFile() error")
+		}
+	}
+	return thisP.runPlugins(ctx, invocation, request, func(plugin *pluginInvocation, response *pluginpb.CodeGeneratorResponse) error {
+		return errors.Wrapf(writePluginResponse(plugin.out, response), "writePluginResponse() error")
+	})
+}
+
+// compileGo compiles the proto files of invocation in-process into the request protoc would send to plugins.
+func (thisP *Generator) compileGo(ctx context.Context, invocation *protocInvocation, protoDir string) (*pluginpb.CodeGeneratorRequest, error) {
+	var diagnostics []Diagnostic
+	rep := reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+		diagnostics = append(diagnostics, newProtocompileDiagnostic(err, SeverityError, invocation.protoPaths, protoDir))
+		return nil
+	}, func(err reporter.ErrorWithPos) {
+		diagnostics = append(diagnostics, newProtocompileDiagnostic(err, SeverityWarning, invocation.protoPaths, protoDir))
+	})
+	request, err := buildCodeGeneratorRequest(ctx, invocation.protoPaths, invocation.protoFiles, rep)
+	if thisP.DiagnosticFormat == DiagnosticFormatRaw {
+		for _, diagnostic := range diagnostics {
+			_, _ = fmt.Fprintln(os.Stderr, diagnostic.String())
+		}
+	}
+	thisP.printDiagnostics(diagnostics)
+	if err != nil {
+		return nil, &ProtocError{Diagnostics: diagnostics, Err: errors.Wrapf(err, "buildCodeGeneratorRequest() error")}
+	}
+	request.CompilerVersion = thisP.compilerVersion()
+	thisP.Logger.Infof("compile proto files ok: count=[%d]", len(request.FileToGenerate))
+	return request, nil
+}
+
+// runPlugins runs the plugins of invocation on request, passing each response to handle.
+func (thisP *Generator) runPlugins(ctx context.Context, invocation *protocInvocation, request *pluginpb.CodeGeneratorRequest,
+	handle func(plugin *pluginInvocation, response *pluginpb.CodeGeneratorResponse) error) error {
+	for _, plugin := range invocation.plugins {
+		request.Parameter = proto.String(strings.Join(plugin.opts, ","))
+		response, err := runPlugin(ctx, plugin.path, request)
+		if err != nil {
+			return errors.Wrapf(err, "runPlugin() error: plugin=[%s]", plugin.name)
+		}
+		if err = handle(plugin, response); err != nil {
+			return errors.Wrapf(err, "plugin response error: plugin=[%s]", plugin.name)
+		}
+		thisP.Logger.Infof("plugin ok: plugin=[%s], files=[%d]", plugin.name, len(response.File))
+	}
+	return nil
+}
+
+// buildCodeGeneratorRequest compiles protoFiles the way protoc would with the given proto_path list.
+func buildCodeGeneratorRequest(ctx context.Context, protoPaths []string, protoFiles []string, rep reporter.Reporter) (*pluginpb.CodeGeneratorRequest, error) {
+	fileNames := make([]string, 0, len(protoFiles))
+	for _, protoFile := range protoFiles {
+		fileName, err := relativeToProtoPath(protoPaths, protoFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "relativeToProtoPath() error")
+		}
+		fileNames = append(fileNames, fileName)
+	}
+
+	compiler := protocompile.Compiler{
+		Resolver:       protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: protoPaths}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+		Reporter:       rep,
+	}
+	files, err := compiler.Compile(ctx, fileNames...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "compiler.Compile() error")
+	}
+
+	request := &pluginpb.CodeGeneratorRequest{FileToGenerate: fileNames}
+	seen := map[string]bool{}
+	var addFile func(fd protoreflect.FileDescriptor)
+	addFile = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			addFile(imports.Get(i).FileDescriptor)
+		}
+		request.ProtoFile = append(request.ProtoFile, toFileDescriptorProto(fd))
+	}
+	for _, file := range files {
+		addFile(file)
+	}
+	return request, nil
+}
+
+func toFileDescriptorProto(fd protoreflect.FileDescriptor) *descriptorpb.FileDescriptorProto {
+	if res, ok := fd.(linker.Result); ok {
+		return res.FileDescriptorProto()
+	}
+	return protodesc.ToFileDescriptorProto(fd)
+}
+
+func relativeToProtoPath(protoPaths []string, protoFile string) (string, error) {
+	for _, protoPath := range protoPaths {
+		rel, err := filepath.Rel(protoPath, protoFile)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return filepath.ToSlash(rel), nil
+	}
+	return "", fmt.Errorf("file is not in any --proto_path: [%s]", protoFile)
+}
+
+func runPlugin(ctx context.Context, pluginPath string, request *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+	requestBytes, err := proto.Marshal(request)
+	if err != nil {
+		return nil, errors.Wrapf(err, "proto.Marshal() error")
+	}
+	stdout := bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, pluginPath)
+	cmd.Stdin = bytes.NewReader(requestBytes)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err = cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "cmd.Run() error: cmd=[%+v]", cmd)
+	}
+	response := &pluginpb.CodeGeneratorResponse{}
+	if err = proto.Unmarshal(stdout.Bytes(), response); err != nil {
+		return nil, errors.Wrapf(err, "proto.Unmarshal() error")
+	}
+	if response.Error != nil {
+		return nil, fmt.Errorf("plugin error: [%s]", response.GetError())
+	}
+	return response, nil
+}
+
+func writePluginResponse(outDir string, response *pluginpb.CodeGeneratorResponse) error {
+	for _, file := range response.File {
+		if file.GetInsertionPoint() != "" {
+			return fmt.Errorf("insertion point not supported: file=[%s], insertionPoint=[%s]", file.GetName(), file.GetInsertionPoint())
+		}
+		outFile := filepath.Join(outDir, filepath.FromSlash(file.GetName()))
+		if rel, err := filepath.Rel(outDir, outFile); err != nil || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("%s: illegal file path", file.GetName())
+		}
+		if err := os.MkdirAll(filepath.Dir(outFile), 0755); err != nil {
+			return errors.Wrapf(err, "os.MkdirAll() error")
+		}
+		if err := os.WriteFile(outFile, []byte(file.GetContent()), 0666); err != nil {
+			return errors.Wrapf(err, "os.WriteFile() error")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package goprotoc
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
+	"testing"
+)
+
+func TestCompilerVersion(t *testing.T) {
+	version := func(major, minor, patch int32, suffix string) *pluginpb.Version {
+		v := &pluginpb.Version{Major: proto.Int32(major), Minor: proto.Int32(minor), Patch: proto.Int32(patch)}
+		if suffix != "" {
+			v.Suffix = proto.String(suffix)
+		}
+		return v
+	}
+	tests := []struct {
+		protocVer string
+		want      *pluginpb.Version
+	}{
+		{protocVer: "", want: version(5, 27, 2, "")},
+		{protocVer: "21.12", want: version(3, 21, 12, "")},
+		{protocVer: "25.1", want: version(4, 25, 1, "")},
+		{protocVer: "28.0-rc1", want: version(5, 28, 0, "rc1")},
+		{protocVer: "31.1", want: version(6, 31, 1, "")},
+		{protocVer: "3.20.3", want: version(3, 20, 3, "")},
+		{protocVer: "latest", want: nil},
+	}
+	for _, test := range tests {
+		generator := &Generator{ProtocVer: test.protocVer}
+		if got := generator.compilerVersion(); !proto.Equal(got, test.want) {
+			t.Errorf("compilerVersion(%s) = %v, want %v", test.protocVer, got, test.want)
+		}
+	}
+	if err := Backend("gRPC").validate(); err == nil {
+		t.Errorf("Backend.validate() of an unknown backend: want an error")
+	}
+}
@@ -0,0 +1,117 @@
+package goprotoc
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// inferGoMappings parses the imports reachable from protoFiles and returns an M mapping for every imported file
+// without option go_package, found in the dir of an imported Go package: the import path of the Go package
+// dir the file is in. Files already in GoOptions.Mappings are skipped.
+// importPkgDirs maps the dirs of the imported Go packages and of the discovered module roots to their import paths.
+func (thisP *Generator) inferGoMappings(protoPaths, protoFiles []string, importPkgDirs map[string]string) (map[string]string, error) {
+	visited := map[string]bool{}
+	var pending []string
+	for _, protoFile := range protoFiles {
+		name, err := relativeToProtoPath(protoPaths, protoFile)
+		if err != nil {
+			return nil, err
+		}
+		visited[name] = true
+		pending = append(pending, protoFile)
+	}
+
+	mappings := map[string]string{}
+	for len(pending) > 0 {
+		file := pending[0]
+		pending = pending[1:]
+		info, err := parseProtoFileInfo(file)
+		if err != nil {
+			// left to the compiler, which reports it with a position
+			continue
+		}
+		for _, imported := range info.imports {
+			if visited[imported.path] {
+				continue
+			}
+			visited[imported.path] = true
+			found := findProtoFile(protoPaths, imported.path)
+			if len(found) == 0 {
+				continue
+			}
+			importedInfo, err := parseProtoFileInfo(filepath.Join(found[0], filepath.FromSlash(imported.path)))
+			if err != nil {
+				continue
+			}
+			pending = append(pending, importedInfo.path)
+			if importedInfo.goPackage != "" {
+				continue
+			}
+			if _, ok := thisP.GoOptions.Mappings[imported.path]; ok {
+				continue
+			}
+			goPkgs := map[string]string{} // Go import path -> file
+			for _, protoPath := range found {
+				if importPath, ok := importPkgDirs[protoPath]; ok {
+					goPkgs[path.Join(importPath, path.Dir(imported.path))] = filepath.Join(protoPath, filepath.FromSlash(imported.path))
+				}
+			}
+			switch len(goPkgs) {
+			case 0:
+				continue
+			case 1:
+			default:
+				candidates := make([]string, 0, len(goPkgs))
+				for _, goPkg := range sortedKeys(goPkgs) {
+					candidates = append(candidates, fmt.Sprintf("%s (%s)", goPkg, goPkgs[goPkg]))
+				}
+				return nil, fmt.Errorf("%s:%d: cannot infer the Go package of [%s] without go_package, found in more than one Go package: %s; set it in GoOptions.Mappings",
+					info.path, imported.line, imported.path, strings.Join(candidates, ", "))
+			}
+			for goPkg, goPkgFile := range goPkgs {
+				mappings[imported.path] = goPkg
+				thisP.Logger.Infof("inferred go_package of [%s] without go_package: [M%s=%s], file=[%s]", imported.path, imported.path, goPkg, goPkgFile)
+			}
+		}
+	}
+	return mappings, nil
+}
+
+// findProtoFile returns the proto paths containing the file imported as name, in order, the first being the one protoc uses.
+func findProtoFile(protoPaths []string, name string) []string {
+	var found []string
+	for _, protoPath := range protoPaths {
+		if stat, err := os.Stat(filepath.Join(protoPath, filepath.FromSlash(name))); err == nil && !stat.IsDir() && !containsPath(found, protoPath) {
+			found = append(found, protoPath)
+		}
+	}
+	return found
+}
+
+// applyGoMappings adds the inferred M mappings to the go and go-grpc plugins, unless their params already map the file.
+func applyGoMappings(invocation *protocInvocation, mappings map[string]string) {
+	files := sortedKeys(mappings)
+	for _, plugin := range invocation.plugins {
+		if plugin.name != "go" && plugin.name != "go-grpc" {
+			continue
+		}
+		for _, file := range files {
+			if !plugin.hasParam("M" + file) {
+				plugin.opts = append(plugin.opts, "M"+file+"="+mappings[file])
+			}
+		}
+	}
+}
+
+// hasParam reports whether the plugin already has a param with key.
+func (thisP *pluginInvocation) hasParam(key string) bool {
+	for _, opt := range thisP.opts {
+		if optKey, _, _ := strings.Cut(opt, "="); optKey == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package goprotoc
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PathsMode is the paths option of protoc-gen-go and protoc-gen-go-grpc.
+type PathsMode string
+
+const (
+	// PathsModule writes files by Go import path relative to the module path, the default.
+	PathsModule PathsMode = "module"
+	// PathsImport writes files by full Go import path.
+	PathsImport PathsMode = "import"
+	// PathsSourceRelative writes files next to the path of their .proto file.
+	PathsSourceRelative PathsMode = "source_relative"
+)
+
+// GoOptions are the options of the default go and go-grpc plugins; a Plugin replacing one of them ignores them.
+type GoOptions struct {
+	Paths           PathsMode
+	OutDir          string            // out dir of the go and go-grpc plugins relative to the module dir, empty for the module dir
+	Mappings        map[string]string // .proto file as imported -> Go import path, rendered as M<file>=<import path>
+	DefaultAPILevel string            // API_OPEN, API_HYBRID or API_OPAQUE, needs protoc-gen-go v1.36+
+
+	GrpcRequireUnimplementedServers *bool // nil for the plugin default, true
+	GrpcUseGenericStreams           *bool // use_generic_streams_experimental, nil for the plugin default
+}
+
+func (thisV GoOptions) validate() error {
+	switch thisV.Paths {
+	case "", PathsModule, PathsImport, PathsSourceRelative:
+	default:
+		return fmt.Errorf("GoOptions.Paths: expect one of [%s %s %s], got [%s]", PathsModule, PathsImport, PathsSourceRelative, thisV.Paths)
+	}
+	if thisV.OutDir != "" && !filepath.IsLocal(filepath.FromSlash(thisV.OutDir)) {
+		return fmt.Errorf("GoOptions.OutDir must be relative to the module dir: [%s]", thisV.OutDir)
+	}
+	for _, file := range sortedKeys(thisV.Mappings) {
+		importPath := thisV.Mappings[file]
+		if !strings.HasSuffix(file, ".proto") || filepath.IsAbs(file) || strings.Contains(file, ",") {
+			return fmt.Errorf("GoOptions.Mappings: expect a .proto file path as imported, without comma: [%s]", file)
+		}
+		if importPath == "" || strings.ContainsAny(importPath, ", ") {
+			return fmt.Errorf("GoOptions.Mappings: invalid Go import path for [%s]: [%s]", file, importPath)
+		}
+	}
+	switch thisV.DefaultAPILevel {
+	case "", "API_OPEN", "API_HYBRID", "API_OPAQUE":
+	default:
+		return fmt.Errorf("GoOptions.DefaultAPILevel: expect one of [API_OPEN API_HYBRID API_OPAQUE], got [%s]", thisV.DefaultAPILevel)
+	}
+	return nil
+}
+
+// pathsOpts are the opts shared by go and go-grpc.
+func (thisV GoOptions) pathsOpts() []string {
+	var opts []string
+	switch thisV.Paths {
+	case "", PathsModule:
+		opts = append(opts, "module={{.ModulePath}}")
+	default:
+		opts = append(opts, "paths="+string(thisV.Paths))
+	}
+	for _, file := range sortedKeys(thisV.Mappings) {
+		opts = append(opts, "M"+file+"="+thisV.Mappings[file])
+	}
+	return opts
+}
+
+func (thisV GoOptions) goOpts() []string {
+	opts := thisV.pathsOpts()
+	if thisV.DefaultAPILevel != "" {
+		opts = append(opts, "default_api_level="+thisV.DefaultAPILevel)
+	}
+	return opts
+}
+
+func (thisV GoOptions) grpcOpts() []string {
+	opts := thisV.pathsOpts()
+	if thisV.GrpcRequireUnimplementedServers != nil {
+		opts = append(opts, "require_unimplemented_servers="+strconv.FormatBool(*thisV.GrpcRequireUnimplementedServers))
+	}
+	if thisV.GrpcUseGenericStreams != nil {
+		opts = append(opts, "use_generic_streams_experimental="+strconv.FormatBool(*thisV.GrpcUseGenericStreams))
+	}
+	return opts
+}
@@ -0,0 +1,138 @@
+package goprotoc
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// checkGoPackages validates the go_package of every proto file before generation, returning a *ProtocError with
+// a diagnostic per violation: with paths=module go_package must be inside the module, the files of a dir must agree on it,
+// and the go plugin must write the files of genPkg's module under one of the CleanDir dirs.
+// M params of the go plugin override go_package; nothing is checked if no go plugin runs.
+// groups and gen.invocations are in the same order.
+func (thisP *Generator) checkGoPackages(gen *generation, groups []*protoFileGroup) error {
+	protoDir := thisP.getProtoDirAbs(gen.genFilePkg.Dir)
+	cleanDirs := thisP.getCleanDirsAbs(gen.genFilePkg.Dir)
+
+	var diagnostics []Diagnostic
+	report := func(info *protoFileInfo, format string, args ...any) {
+		diagnostic := Diagnostic{Line: info.goPackageLine, Column: info.goPackageCol, Severity: SeverityError, Message: fmt.Sprintf(format, args...)}
+		diagnostic.File, diagnostic.absFile = resolveDiagnosticFile(info.path, nil, protoDir)
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	dirInfos, dirGoPackages := map[string]*protoFileInfo{}, map[string]string{} // dir -> first file with a go_package
+	for i, group := range groups {
+		invocation := gen.invocations[i]
+		goPlugin := invocation.plugin("go")
+		if goPlugin == nil {
+			continue
+		}
+		opts := parseGoPluginOpts(goPlugin.opts)
+		for _, protoFile := range group.protoFiles {
+			info, err := parseProtoFileInfo(protoFile)
+			if err != nil {
+				// left to the compiler, which reports it with a position
+				continue
+			}
+			name, err := relativeToProtoPath(invocation.protoPaths, protoFile)
+			if err != nil {
+				return err
+			}
+			goPackage := info.goPackage
+			if mapped, ok := opts.mappings[name]; ok {
+				goPackage = mapped
+			}
+			if goPackage == "" {
+				report(info, "missing option go_package, expect a Go import path in module [%s]", group.module.Path)
+				continue
+			}
+			if opts.paths == PathsModule && goPackage != opts.module && !strings.HasPrefix(goPackage, opts.module+"/") {
+				report(info, "go_package [%s] is not inside module [%s], required by paths=module", goPackage, opts.module)
+				continue
+			}
+			dir := filepath.Dir(protoFile)
+			if first, ok := dirInfos[dir]; !ok {
+				dirInfos[dir], dirGoPackages[dir] = info, goPackage
+			} else if dirGoPackages[dir] != goPackage {
+				firstFile, _ := resolveDiagnosticFile(first.path, nil, protoDir)
+				report(info, "go_package [%s] differs from [%s] of %s:%d in the same dir", goPackage, dirGoPackages[dir], firstFile, first.goPackageLine)
+			}
+			if group.module.Path != gen.genPkg.Module.Path {
+				continue
+			}
+			outDir, err := opts.outDir(invocation, goPlugin, goPackage, name)
+			if err != nil {
+				return err
+			}
+			if !isInAnyDir(outDir, cleanDirs) {
+				report(info, "go_package [%s] is generated into [%s], not under CleanDir %v", goPackage, outDir, cleanDirs)
+			}
+		}
+	}
+	if len(diagnostics) == 0 {
+		return nil
+	}
+	thisP.printDiagnostics(diagnostics)
+	return &ProtocError{Diagnostics: diagnostics, Err: fmt.Errorf("go_package check failed: %d error(s)", len(diagnostics))}
+}
+
+// goPluginOpts are the params of the go plugin deciding where it writes a file.
+type goPluginOpts struct {
+	module   string // prefix stripped from the Go import path with module=
+	paths    PathsMode
+	mappings map[string]string
+}
+
+func parseGoPluginOpts(opts []string) goPluginOpts {
+	parsed := goPluginOpts{paths: PathsImport, mappings: map[string]string{}}
+	for _, opt := range opts {
+		key, value, _ := strings.Cut(opt, "=")
+		switch {
+		case key == "module":
+			parsed.module, parsed.paths = value, PathsModule
+		case key == "paths":
+			parsed.paths = PathsMode(value)
+		case strings.HasPrefix(key, "M"):
+			parsed.mappings[strings.TrimPrefix(key, "M")] = value
+		}
+	}
+	return parsed
+}
+
+// outDir is the dir under the module dir the go plugin writes the file named name with go_package goPackage into.
+func (thisV goPluginOpts) outDir(invocation *protocInvocation, goPlugin *pluginInvocation, goPackage, name string) (string, error) {
+	pluginDir, err := filepath.Rel(invocation.outDir, goPlugin.out)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Rel() error: [%w]", err)
+	}
+	outDir := filepath.Join(invocation.moduleDir, pluginDir)
+	switch thisV.paths {
+	case PathsModule:
+		return filepath.Join(outDir, filepath.FromSlash(strings.TrimPrefix(strings.TrimPrefix(goPackage, thisV.module), "/"))), nil
+	case PathsSourceRelative:
+		return filepath.Join(outDir, filepath.FromSlash(path.Dir(name))), nil
+	default:
+		return filepath.Join(outDir, filepath.FromSlash(goPackage)), nil
+	}
+}
+
+// plugin returns the plugin named name, nil if it does not run.
+func (thisP *protocInvocation) plugin(name string) *pluginInvocation {
+	for _, plugin := range thisP.plugins {
+		if plugin.name == name {
+			return plugin
+		}
+	}
+	return nil
+}
+
+func isInAnyDir(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package goprotoc
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sky91/go-protoc/internal"
+	"strings"
+)
+
+// resolveProtocGenGoGrpcVer picks protoc-gen-go-grpc from Generator.ProtocGenGoGrpcVer, then go.mod (it is a separate
+// module from google.golang.org/grpc), then the newest release compatible with the grpc runtime in go.mod.
+func (thisP *Generator) resolveProtocGenGoGrpcVer() (string, error) {
+	grpcMod, cmd, err := internal.GoListMod(pkgNameGrpc)
+	if err != nil {
+		return "", errors.Wrapf(err, "GoListMod() error: cmd=[%+v]", cmd)
+	}
+	runtimeVer := grpcMod.Version
+	if grpcMod.Replace != nil && grpcMod.Replace.Version != "" {
+		runtimeVer = grpcMod.Replace.Version
+	}
+
+	var version string
+	if thisP.ProtocGenGoGrpcVer != "" {
+		version = "v" + strings.TrimPrefix(thisP.ProtocGenGoGrpcVer, "v")
+		thisP.Logger.Infof("protoc-gen-go-grpc version from Generator.ProtocGenGoGrpcVer: [%s]", version)
+	} else if pluginMod, cmd, err := internal.GoListMod(pkgNameProtocGenGoGrpc); err != nil {
+		return "", errors.Wrapf(err, "GoListMod() error: cmd=[%+v]", cmd)
+	} else if pluginMod.Error == nil && pluginMod.Version != "" {
+		version = pluginMod.Version
+		thisP.Logger.Infof("protoc-gen-go-grpc version from go.mod: [%s]", version)
+	} else {
+		version = protocGenGoGrpcCompat[len(protocGenGoGrpcCompat)-1].pluginVer
+		for _, compat := range protocGenGoGrpcCompat {
+			if internal.CompareSemver(runtimeVer, compat.minRuntimeVer) >= 0 {
+				version = compat.pluginVer
+				break
+			}
+		}
+		thisP.Logger.Infof("protoc-gen-go-grpc version for %s@%s: [%s]", pkgNameGrpc, runtimeVer, version)
+	}
+
+	for _, compat := range protocGenGoGrpcCompat {
+		if internal.CompareSemver(version, compat.pluginVer) >= 0 {
+			if runtimeVer != "" && internal.CompareSemver(runtimeVer, compat.minRuntimeVer) < 0 {
+				thisP.Logger.Errorf("protoc-gen-go-grpc@%s generates code requiring %s@%s or later, but go.mod has [%s]",
+					version, pkgNameGrpc, compat.minRuntimeVer, runtimeVer)
+			}
+			break
+		}
+	}
+	return version, nil
+}
+
+// protocGenGoGrpcCompat lists protoc-gen-go-grpc releases, newest first, with the grpc runtime their code requires.
+var protocGenGoGrpcCompat = []struct {
+	pluginVer     string
+	minRuntimeVer string
+}{
+	{pluginVer: "v1.5.1", minRuntimeVer: "v1.64.0"},
+	{pluginVer: "v1.4.0", minRuntimeVer: "v1.62.0"},
+	{pluginVer: "v1.3.0", minRuntimeVer: "v1.32.0"},
+}
@@ -0,0 +1,153 @@
+package goprotoc
+
+import (
+	"fmt"
+	"github.com/sky91/go-protoc/internal"
+	"sort"
+)
+
+// IDEIntegration points an IDE or language server at the proto paths of the packages Run generates for.
+// Implementations must be idempotent and only change the entries they own for IDEPackage.ImportPath.
+type IDEIntegration interface {
+	Name() string
+	Configure(pkg IDEPackage) error
+}
+
+// IDEPackage is the package an IDEIntegration is configured for.
+type IDEPackage struct {
+	ImportPath       string // owner of the entries the integration writes
+	Dir              string
+	ModuleDir        string
+	ImportProtoPaths []string // dirs of the Go packages the generate file imports
+	ProtoPaths       []string // every --proto_path of the protoc run
+}
+
+// JetBrainsIDE configures the import paths of the ProtoEditor plugin in the nearest .idea dir, if there is one.
+type JetBrainsIDE struct{}
+
+func (thisV JetBrainsIDE) Name() string {
+	return "jetbrains"
+}
+
+func (thisV JetBrainsIDE) Configure(pkg IDEPackage) error {
+	protoEditor, err := internal.FindJetBrainsRootAndOpen(pkg.Dir)
+	if err != nil {
+		return nil
+	}
+	protoEditor.ConfigProtoPath(pkg.ImportPath, pkg.ImportProtoPaths)
+	if err = protoEditor.Save(); err != nil {
+		return fmt.Errorf("func protoEditor.Save() error: [%w]", err)
+	}
+	return nil
+}
+
+// VSCodeIDE configures the protoc.options --proto_path entries, used by the vscode-proto3 extension,
+// in the nearest .vscode/settings.json, or creates it in the module dir.
+// A settings.json with comments or trailing commas is left untouched, the error returned lists the options to set by hand.
+type VSCodeIDE struct{}
+
+func (thisV VSCodeIDE) Name() string {
+	return "vscode"
+}
+
+func (thisV VSCodeIDE) Configure(pkg IDEPackage) error {
+	vsCodeSettings, err := internal.FindVSCodeRootAndOpen(pkg.Dir, pkg.ModuleDir)
+	if err != nil {
+		return fmt.Errorf("func internal.FindVSCodeRootAndOpen() error: [%w]", err)
+	}
+	if err = vsCodeSettings.ConfigProtoPath(pkg.ImportPath, pkg.ProtoPaths); err != nil {
+		return fmt.Errorf("func vsCodeSettings.ConfigProtoPath() error: [%w]", err)
+	}
+	if err = vsCodeSettings.Save(); err != nil {
+		return fmt.Errorf("func vsCodeSettings.Save() error: [%w]", err)
+	}
+	return nil
+}
+
+// ProtolsIDE configures the include_paths of the protols language server in the nearest protols.toml,
+// or creates it in the module dir.
+type ProtolsIDE struct{}
+
+func (thisV ProtolsIDE) Name() string {
+	return "protols"
+}
+
+func (thisV ProtolsIDE) Configure(pkg IDEPackage) error {
+	protolsConfig, err := internal.FindProtolsRootAndOpen(pkg.Dir, pkg.ModuleDir)
+	if err != nil {
+		return fmt.Errorf("func internal.FindProtolsRootAndOpen() error: [%w]", err)
+	}
+	if err = protolsConfig.ConfigIncludePaths(pkg.ImportPath, pkg.ProtoPaths); err != nil {
+		return fmt.Errorf("func protolsConfig.ConfigIncludePaths() error: [%w]", err)
+	}
+	if err = protolsConfig.Save(); err != nil {
+		return fmt.Errorf("func protolsConfig.Save() error: [%w]", err)
+	}
+	return nil
+}
+
+var ideIntegrations = map[string]IDEIntegration{
+	JetBrainsIDE{}.Name(): JetBrainsIDE{},
+	VSCodeIDE{}.Name():    VSCodeIDE{},
+	ProtolsIDE{}.Name():   ProtolsIDE{},
+}
+
+// IDEIntegrationByName returns the built-in IDEIntegration named name: jetbrains, vscode or protols.
+func IDEIntegrationByName(name string) (IDEIntegration, error) {
+	integration, ok := ideIntegrations[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown IDE integration: [%s], expect one of %v", name, IDEIntegrationNames())
+	}
+	return integration, nil
+}
+
+// IDEIntegrationNames returns the names of the built-in IDE integrations.
+func IDEIntegrationNames() []string {
+	names := make([]string, 0, len(ideIntegrations))
+	for name := range ideIntegrations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getIDEIntegrations returns IDEIntegrations, JetBrains only if nil, without JetBrains if DisableJetBrains is set.
+func (thisP *Generator) getIDEIntegrations() []IDEIntegration {
+	integrations := thisP.IDEIntegrations
+	if integrations == nil {
+		integrations = []IDEIntegration{JetBrainsIDE{}}
+	}
+	if !thisP.DisableJetBrains {
+		return integrations
+	}
+	enabled := make([]IDEIntegration, 0, len(integrations))
+	for _, integration := range integrations {
+		if integration.Name() != (JetBrainsIDE{}).Name() {
+			enabled = append(enabled, integration)
+		}
+	}
+	return enabled
+}
+
+// configIDEs runs every IDE integration, logging the ones failing without stopping the others.
+func (thisP *Generator) configIDEs(gen *generation) {
+	pkg := IDEPackage{
+		ImportPath:       gen.genPkg.ImportPath,
+		Dir:              gen.genPkg.Dir,
+		ModuleDir:        gen.genPkg.Dir,
+		ImportProtoPaths: gen.importProtoPaths,
+	}
+	if gen.genPkg.Module != nil && gen.genPkg.Module.Dir != "" {
+		pkg.ModuleDir = gen.genPkg.Module.Dir
+	}
+	if len(gen.invocations) > 0 {
+		pkg.ProtoPaths = gen.invocations[0].protoPaths
+	}
+	for _, integration := range thisP.getIDEIntegrations() {
+		if err := integration.Configure(pkg); err != nil {
+			thisP.Logger.Errorf("IDE integration error: [%s], err=[%+v]", integration.Name(), err)
+			continue
+		}
+		thisP.Logger.Infof("IDE integration ok: [%s]", integration.Name())
+	}
+}
@@ -0,0 +1,214 @@
+package goprotoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sky91/go-protoc/internal"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// generationManifest records the inputs of the last successful generation of a package, so Incremental can skip it.
+type generationManifest struct {
+	ProtocVer  string
+	ArgsSHA256 string
+	Plugins    map[string]string // plugin name -> binary sha256
+	Inputs     map[string]string // .proto file -> sha256
+	Outputs    map[string]string // generated file -> sha256
+}
+
+func (thisP *Generator) buildGenerationManifest(invocations []*protocInvocation) (*generationManifest, error) {
+	var argsBytes []byte
+	for _, invocation := range invocations {
+		argsBytes = append(argsBytes, invocation.argsFileBytes()...)
+	}
+	invocation := invocations[0]
+	manifest := &generationManifest{
+		ProtocVer:  string(thisP.getBackend()),
+		ArgsSHA256: sha256Hex(argsBytes),
+		Plugins:    map[string]string{},
+		Inputs:     map[string]string{},
+	}
+	if thisP.getBackend() == BackendProtoc {
+		manifest.ProtocVer += ":" + thisP.getProtocVer()
+	}
+	for _, plugin := range invocation.plugins {
+		pluginBytes, err := os.ReadFile(plugin.path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "os.ReadFile() error")
+		}
+		manifest.Plugins[plugin.name] = sha256Hex(pluginBytes)
+	}
+	var protoFiles []string
+	for _, invocation := range invocations {
+		protoFiles = append(protoFiles, invocation.protoFiles...)
+	}
+	for _, path := range collectProtoInputs(invocation.protoPaths, protoFiles) {
+		fileBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "os.ReadFile() error")
+		}
+		manifest.Inputs[path] = sha256Hex(fileBytes)
+	}
+	return manifest, nil
+}
+
+// collectProtoInputs returns protoFiles and the files they import, transitively, each resolved to the first proto path
+// holding it as protoc does, so a file shadowing an import changes the inputs. Imports found nowhere are left out.
+func collectProtoInputs(protoPaths, protoFiles []string) []string {
+	inputs := append([]string{}, protoFiles...)
+	visited := map[string]bool{}
+	for _, protoFile := range protoFiles {
+		visited[protoFile] = true
+	}
+	for i := 0; i < len(inputs); i++ {
+		info, err := parseProtoFileInfo(inputs[i])
+		if err != nil {
+			// hashed as is, the compiler reports it
+			continue
+		}
+		for _, imported := range info.imports {
+			dirs := findProtoFile(protoPaths, imported.path)
+			if len(dirs) == 0 {
+				continue
+			}
+			if path := filepath.Join(dirs[0], filepath.FromSlash(imported.path)); !visited[path] {
+				visited[path] = true
+				inputs = append(inputs, path)
+			}
+		}
+	}
+	return inputs
+}
+
+// staleReason explains why the generation recorded in prev cannot be reused, or returns "" if it can.
+func (thisP *generationManifest) staleReason(prev *generationManifest) string {
+	if prev == nil {
+		return "no previous manifest"
+	}
+	if thisP.ProtocVer != prev.ProtocVer {
+		return fmt.Sprintf("protoc changed: [%s] -> [%s]", prev.ProtocVer, thisP.ProtocVer)
+	}
+	if reason := diffHashes("plugin", prev.Plugins, thisP.Plugins); reason != "" {
+		return reason
+	}
+	if reason := diffHashes("input", prev.Inputs, thisP.Inputs); reason != "" {
+		return reason
+	}
+	if thisP.ArgsSHA256 != prev.ArgsSHA256 {
+		return "proto gen file args changed"
+	}
+	current := map[string]string{}
+	for file := range prev.Outputs {
+		if fileBytes, err := os.ReadFile(file); err == nil {
+			current[file] = sha256Hex(fileBytes)
+		}
+	}
+	return diffHashes("output", prev.Outputs, current)
+}
+
+func diffHashes(kind string, prev, current map[string]string) string {
+	keys := make([]string, 0, len(prev)+len(current))
+	for key := range current {
+		keys = append(keys, key)
+	}
+	for key := range prev {
+		if _, ok := current[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		prevHash, inPrev := prev[key]
+		currentHash, inCurrent := current[key]
+		switch {
+		case !inPrev:
+			return fmt.Sprintf("%s added: [%s]", kind, key)
+		case !inCurrent:
+			return fmt.Sprintf("%s removed: [%s]", kind, key)
+		case prevHash != currentHash:
+			return fmt.Sprintf("%s changed: [%s]", kind, key)
+		}
+	}
+	return ""
+}
+
+// collectOutputs records the files of cleanDirs as outputs, except the ones in kept left unchanged by the generation.
+func (thisP *generationManifest) collectOutputs(cleanDirs []string, kept map[string]string) error {
+	outputs, err := hashDirFiles(cleanDirs)
+	if err != nil {
+		return errors.Wrapf(err, "hashDirFiles() error")
+	}
+	for path, hash := range kept {
+		if outputs[path] == hash {
+			delete(outputs, path)
+		}
+	}
+	thisP.Outputs = outputs
+	return nil
+}
+
+// hashDirFiles returns the sha256 of every file under dirs.
+func hashDirFiles(dirs []string) (map[string]string, error) {
+	hashes := map[string]string{}
+	for _, dir := range dirs {
+		files, err := listFilesRel(dir, dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "listFilesRel() error")
+		}
+		for _, file := range files {
+			path := filepath.Join(dir, filepath.FromSlash(file))
+			fileBytes, err := os.ReadFile(path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "os.ReadFile() error")
+			}
+			hashes[path] = sha256Hex(fileBytes)
+		}
+	}
+	return hashes, nil
+}
+
+// output returns the hash of a generated file of the last generation, nil-safe.
+func (thisP *generationManifest) output(path string) (string, bool) {
+	if thisP == nil {
+		return "", false
+	}
+	hash, ok := thisP.Outputs[path]
+	return hash, ok
+}
+
+func readGenerationManifest(path string) *generationManifest {
+	manifestBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	manifest := &generationManifest{}
+	if err = json.Unmarshal(manifestBytes, manifest); err != nil {
+		return nil
+	}
+	return manifest
+}
+
+func (thisP *generationManifest) save(path string) error {
+	manifestBytes, err := json.MarshalIndent(thisP, "", "\t")
+	if err != nil {
+		return errors.Wrapf(err, "json.MarshalIndent() error")
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "os.MkdirAll() error")
+	}
+	if err = writeFileAtomic(path, manifestBytes); err != nil {
+		return errors.Wrapf(err, "writeFileAtomic() error")
+	}
+	return nil
+}
+
+// getGenerationManifestPath is in the cache dir, which tmp cleaners leave alone, keyed on the package dir too,
+// so checkouts of the same module do not share it.
+func (thisP *Generator) getGenerationManifestPath(genPkg *internal.PackagePublic) string {
+	name := regexp.MustCompile(`\W+`).ReplaceAllString(genPkg.ImportPath, "_") + "-" + sha256Hex([]byte(genPkg.Dir))[:16]
+	return filepath.Join(manifestDir, name, "manifest.json")
+}
@@ -0,0 +1,39 @@
+package goprotoc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCollectProtoInputs(t *testing.T) {
+	root := t.TempDir()
+	for file, content := range map[string]string{
+		"proto/a.proto":       "syntax = \"proto3\";\nimport \"dep/b.proto\";\nimport \"google/protobuf/empty.proto\";\n",
+		"first/dep/b.proto":   "syntax = \"proto3\";\nimport \"dep/c.proto\";\nimport \"missing.proto\";\n",
+		"second/dep/b.proto":  "syntax = \"proto3\";\n",
+		"second/dep/c.proto":  "syntax = \"proto3\";\nimport \"dep/b.proto\";\n",
+		"second/unused.proto": "syntax = \"proto3\";\n",
+		"second/broken.proto": "syntax = \n",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("os.MkdirAll() error: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("os.WriteFile() error: %v", err)
+		}
+	}
+	protoPaths := []string{filepath.Join(root, "proto"), filepath.Join(root, "first"), filepath.Join(root, "second")}
+	got := collectProtoInputs(protoPaths, []string{filepath.Join(root, "proto", "a.proto"), filepath.Join(root, "second", "broken.proto")})
+	want := []string{
+		filepath.Join(root, "proto", "a.proto"),
+		filepath.Join(root, "second", "broken.proto"),
+		filepath.Join(root, "first", "dep", "b.proto"),
+		filepath.Join(root, "second", "dep", "c.proto"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collectProtoInputs() = %v, want %v", got, want)
+	}
+}
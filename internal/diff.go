@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UnifiedDiff renders a unified diff between two texts, with 3 lines of context.
+func UnifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+	ops := diffLines(splitLines(oldText), splitLines(newText))
+
+	const context = 3
+	buf := strings.Builder{}
+	_, _ = fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// hunk [start, end) covers changes whose gaps are not larger than 2*context
+		start := max(i-context, 0)
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*context {
+				end = min(end+context, len(ops))
+				break
+			}
+			end = next
+		}
+
+		oldStart, newStart := ops[start].oldLine, ops[start].newLine
+		oldCount, newCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		_, _ = fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, op := range ops[start:end] {
+			_, _ = fmt.Fprintf(&buf, "%c%s\n", op.kind, op.line)
+		}
+		i = end
+	}
+	return buf.String()
+}
+
+type diffOp struct {
+	kind    byte // ' ', '-' or '+'
+	line    string
+	oldLine int // 1-based line the op applies at in the old text
+	newLine int // 1-based line the op applies at in the new text
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines is the Myers O(ND) diff; very large edit distances fall back to replacing everything.
+func diffLines(a, b []string) []diffOp {
+	const maxEdits = 4000
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int // trace[d][k+d] is v[offset+k] before step d, only for the diagonals step d reads
+	found := false
+	for d := 0; d <= n+m && d <= maxEdits && !found; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	var reversed []diffOp
+	if !found {
+		for i := m - 1; i >= 0; i-- {
+			reversed = append(reversed, diffOp{kind: '+', line: b[i]})
+		}
+		for i := n - 1; i >= 0; i-- {
+			reversed = append(reversed, diffOp{kind: '-', line: a[i]})
+		}
+	} else {
+		x, y := n, m
+		for d := len(trace) - 1; d >= 0; d-- {
+			prevX, prevY := 0, 0
+			if d > 0 {
+				v := trace[d]
+				k := x - y
+				prevK := k - 1
+				if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+					prevK = k + 1
+				}
+				prevX = v[d+prevK]
+				prevY = prevX - prevK
+			}
+			for x > prevX && y > prevY {
+				reversed = append(reversed, diffOp{kind: ' ', line: a[x-1]})
+				x--
+				y--
+			}
+			if d > 0 {
+				if x == prevX {
+					reversed = append(reversed, diffOp{kind: '+', line: b[y-1]})
+					y--
+				} else {
+					reversed = append(reversed, diffOp{kind: '-', line: a[x-1]})
+					x--
+				}
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(reversed))
+	oldLine, newLine := 1, 1
+	for i := len(reversed) - 1; i >= 0; i-- {
+		op := reversed[i]
+		op.oldLine, op.newLine = oldLine, newLine
+		if op.kind != '+' {
+			oldLine++
+		}
+		if op.kind != '-' {
+			newLine++
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(from, to int) string {
+		buf := strings.Builder{}
+		for i := from; i <= to; i++ {
+			_, _ = fmt.Fprintf(&buf, "l%d\n", i)
+		}
+		return buf.String()
+	}
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+		want    string
+	}{
+		{
+			name:    "same",
+			oldText: "a\nb\n",
+			newText: "a\nb\n",
+			want:    "",
+		},
+		{
+			name:    "empty old",
+			oldText: "",
+			newText: "a\nb\n",
+			want:    "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:    "empty new",
+			oldText: "a\nb\n",
+			newText: "",
+			want:    "--- old\n+++ new\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name:    "changed line with context",
+			oldText: lines(1, 9),
+			newText: strings.Replace(lines(1, 9), "l5\n", "x5\n", 1),
+			want:    "--- old\n+++ new\n@@ -2,7 +2,7 @@\n l2\n l3\n l4\n-l5\n+x5\n l6\n l7\n l8\n",
+		},
+		{
+			name:    "changes 6 lines apart merge into one hunk",
+			oldText: lines(1, 12),
+			newText: strings.Replace(strings.Replace(lines(1, 12), "l3\n", "", 1), "l10\n", "", 1),
+			want:    "--- old\n+++ new\n@@ -1,12 +1,10 @@\n l1\n l2\n-l3\n l4\n l5\n l6\n l7\n l8\n l9\n-l10\n l11\n l12\n",
+		},
+		{
+			name:    "changes 7 lines apart make two hunks",
+			oldText: lines(1, 13),
+			newText: strings.Replace(strings.Replace(lines(1, 13), "l3\n", "", 1), "l11\n", "", 1),
+			want:    "--- old\n+++ new\n@@ -1,6 +1,5 @@\n l1\n l2\n-l3\n l4\n l5\n l6\n@@ -8,6 +7,5 @@\n l8\n l9\n l10\n-l11\n l12\n l13\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := UnifiedDiff("old", "new", test.oldText, test.newText); got != test.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	numbered := func(prefix string, count int, changeEvery int) []string {
+		lines := make([]string, count)
+		for i := range lines {
+			lines[i] = fmt.Sprintf("line %d", i)
+			if changeEvery > 0 && i%changeEvery == 0 {
+				lines[i] = fmt.Sprintf("%s %d", prefix, i)
+			}
+		}
+		return lines
+	}
+	tests := []struct {
+		name      string
+		a, b      []string
+		wantEdits int // -1 to only check the ops rebuild both texts
+	}{
+		{name: "few changes", a: numbered("a", 100, 10), b: numbered("b", 100, 10), wantEdits: 20},
+		{name: "many changes in a large file", a: numbered("a", 10000, 5), b: numbered("b", 10000, 5), wantEdits: 4000},
+		{name: "fallback past the max edits", a: numbered("a", 3000, 1), b: numbered("b", 3000, 1), wantEdits: 6000},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ops := diffLines(test.a, test.b)
+			var a, b []string
+			edits := 0
+			for _, op := range ops {
+				if op.kind != '+' {
+					a = append(a, op.line)
+				}
+				if op.kind != '-' {
+					b = append(b, op.line)
+				}
+				if op.kind != ' ' {
+					edits++
+				}
+			}
+			if strings.Join(a, "\n") != strings.Join(test.a, "\n") || strings.Join(b, "\n") != strings.Join(test.b, "\n") {
+				t.Fatalf("ops do not rebuild the texts")
+			}
+			if edits != test.wantEdits {
+				t.Errorf("edits = %d, want %d", edits, test.wantEdits)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// LockFile takes an exclusive advisory lock on path, creating the file if needed.
+// onWait is called once if the lock is held by another process.
+func LockFile(ctx context.Context, path string, timeout time.Duration, onWait func()) (unlock func() error, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile() error: [%w]", err)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	waiting := false
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("tryLockFile() error: [%w]", err)
+		}
+		if locked {
+			return func() error {
+				if err := unlockFile(f); err != nil {
+					_ = f.Close()
+					return fmt.Errorf("unlockFile() error: [%w]", err)
+				}
+				return f.Close()
+			}, nil
+		}
+		if !waiting && onWait != nil {
+			onWait()
+		}
+		waiting = true
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, fmt.Errorf("wait lock error: path=[%s], err=[%w]", path, ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
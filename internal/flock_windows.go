@@ -0,0 +1,43 @@
+//go:build windows
+
+package internal
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modKernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modKernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modKernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+	errorLockViolation      = syscall.Errno(33)
+)
+
+func tryLockFile(f *os.File) (bool, error) {
+	overlapped := &syscall.Overlapped{}
+	r1, _, e1 := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if r1 != 0 {
+		return true, nil
+	}
+	if errors.Is(e1, errorLockViolation) {
+		return false, nil
+	}
+	return false, e1
+}
+
+func unlockFile(f *os.File) error {
+	overlapped := &syscall.Overlapped{}
+	r1, _, e1 := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if r1 == 0 {
+		return e1
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"bytes"
 	"encoding/json"
 	"github.com/pkg/errors"
 	"os"
@@ -23,6 +24,30 @@ func GoListPkg(pkg string, tags []string) (*PackagePublic, *exec.Cmd, error) {
 	return pkgInfo, cmd, json.Unmarshal(cmdOutput, pkgInfo)
 }
 
+// GoListPkgs is GoListPkg for a pattern that may match any number of packages.
+func GoListPkgs(pattern string, tags []string) ([]*PackagePublic, *exec.Cmd, error) {
+	args := []string{"list", "-json", "-e"}
+	if len(tags) > 0 {
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+	args = append(args, pattern)
+	cmd := exec.Command("go", args...)
+	cmdOutput, err := cmd.Output()
+	if err != nil {
+		return nil, cmd, err
+	}
+	var pkgInfos []*PackagePublic
+	decoder := json.NewDecoder(bytes.NewReader(cmdOutput))
+	for decoder.More() {
+		pkgInfo := &PackagePublic{}
+		if err = decoder.Decode(pkgInfo); err != nil {
+			return nil, cmd, err
+		}
+		pkgInfos = append(pkgInfos, pkgInfo)
+	}
+	return pkgInfos, cmd, nil
+}
+
 func GoListMod(mod string) (*ModulePublic, *exec.Cmd, error) {
 	cmd := exec.Command("go", "list", "-json", "-m", "-e", mod)
 	cmdOutput, err := cmd.Output()
@@ -33,12 +58,53 @@ func GoListMod(mod string) (*ModulePublic, *exec.Cmd, error) {
 	return modInfo, cmd, json.Unmarshal(cmdOutput, modInfo)
 }
 
-func GoInstall(pkg, installPath string) (*exec.Cmd, error) {
+// GoListMainMods lists the main module, or every module of the go.work workspace.
+func GoListMainMods() ([]*ModulePublic, *exec.Cmd, error) {
+	cmd := exec.Command("go", "list", "-json", "-m")
+	cmdOutput, err := cmd.Output()
+	if err != nil {
+		return nil, cmd, err
+	}
+	var modInfos []*ModulePublic
+	decoder := json.NewDecoder(bytes.NewReader(cmdOutput))
+	for decoder.More() {
+		modInfo := &ModulePublic{}
+		if err = decoder.Decode(modInfo); err != nil {
+			return nil, cmd, err
+		}
+		modInfos = append(modInfos, modInfo)
+	}
+	return modInfos, cmd, nil
+}
+
+// GoListBuildListMods lists the modules of the build list, main modules first; modules not downloaded have no Dir.
+func GoListBuildListMods() ([]*ModulePublic, *exec.Cmd, error) {
+	cmd := exec.Command("go", "list", "-json", "-m", "-e", "all")
+	cmdOutput, err := cmd.Output()
+	if err != nil {
+		return nil, cmd, err
+	}
+	var modInfos []*ModulePublic
+	decoder := json.NewDecoder(bytes.NewReader(cmdOutput))
+	for decoder.More() {
+		modInfo := &ModulePublic{}
+		if err = decoder.Decode(modInfo); err != nil {
+			return nil, cmd, err
+		}
+		modInfos = append(modInfos, modInfo)
+	}
+	return modInfos, cmd, nil
+}
+
+func GoInstall(pkg, installPath string, env ...string) (*exec.Cmd, error) {
 	cmd := exec.Command("go", "install", pkg)
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
 	if len(installPath) > 0 {
-		cmd.Env = append(os.Environ(), "GOBIN="+installPath)
+		env = append(env, "GOBIN="+installPath)
+	}
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
 	}
 	return cmd, cmd.Run()
 }
@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonObject is a JSON object that keeps the order of its keys, so rewriting a user file only changes the keys touched.
+type jsonObject struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+func parseJSONObject(data []byte) (*jsonObject, error) {
+	object := &jsonObject{values: map[string]json.RawMessage{}}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return object, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("func decoder.Token() error: [%w]", err)
+	} else if token != json.Delim('{') {
+		return nil, fmt.Errorf("expect a JSON object, got: [%v]", token)
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("func decoder.Token() error: [%w]", err)
+		}
+		key := token.(string)
+		value := json.RawMessage{}
+		if err = decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("func decoder.Decode() error: [%w]", err)
+		}
+		if _, ok := object.values[key]; !ok {
+			object.keys = append(object.keys, key)
+		}
+		object.values[key] = value
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("func decoder.Token() error: [%w]", err)
+	}
+	return object, nil
+}
+
+// get decodes the value of key into target, reporting whether key exists.
+func (thisP *jsonObject) get(key string, target any) (bool, error) {
+	value, ok := thisP.values[key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(value, target); err != nil {
+		return true, fmt.Errorf("func json.Unmarshal() error: key=[%s], err=[%w]", key, err)
+	}
+	return true, nil
+}
+
+func (thisP *jsonObject) set(key string, value any) error {
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("func json.Marshal() error: [%w]", err)
+	}
+	if _, ok := thisP.values[key]; !ok {
+		thisP.keys = append(thisP.keys, key)
+	}
+	thisP.values[key] = valueBytes
+	return nil
+}
+
+func (thisP *jsonObject) delete(key string) {
+	if _, ok := thisP.values[key]; !ok {
+		return
+	}
+	delete(thisP.values, key)
+	for i, k := range thisP.keys {
+		if k == key {
+			thisP.keys = append(thisP.keys[:i], thisP.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (thisP *jsonObject) MarshalJSON() ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, key := range thisP.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		keyBytes, err := json.Marshal(key)
+		if err != nil {
+			return nil, fmt.Errorf("func json.Marshal() error: [%w]", err)
+		}
+		buf.Write(keyBytes)
+		buf.WriteByte(':')
+		buf.Write(thisP.values[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (thisP *jsonObject) UnmarshalJSON(data []byte) error {
+	object, err := parseJSONObject(data)
+	if err != nil {
+		return err
+	}
+	*thisP = *object
+	return nil
+}
+
+func (thisP *jsonObject) marshalIndent(indent string) ([]byte, error) {
+	compact, err := thisP.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.Buffer{}
+	if err = json.Indent(&buf, compact, "", indent); err != nil {
+		return nil, fmt.Errorf("func json.Indent() error: [%w]", err)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,44 @@
+package internal
+
+// stripJSONC returns data with the comments and trailing commas of JSONC, as VS Code settings allow, blanked out by spaces,
+// so offsets are kept and plain JSON comes back unchanged.
+func stripJSONC(data []byte) []byte {
+	stripped := append([]byte(nil), data...)
+	lastComma := -1 // offset of a comma only followed by blanks so far
+	for i := 0; i < len(stripped); i++ {
+		switch c := stripped[i]; {
+		case c == '"':
+			lastComma = -1
+			for i++; i < len(stripped) && stripped[i] != '"'; i++ {
+				if stripped[i] == '\\' {
+					i++
+				}
+			}
+		case c == '/' && i+1 < len(stripped) && stripped[i+1] == '/':
+			for ; i < len(stripped) && stripped[i] != '\n'; i++ {
+				stripped[i] = ' '
+			}
+		case c == '/' && i+1 < len(stripped) && stripped[i+1] == '*':
+			stripped[i], stripped[i+1] = ' ', ' '
+			for i += 2; i < len(stripped) && !(stripped[i] == '*' && i+1 < len(stripped) && stripped[i+1] == '/'); i++ {
+				if stripped[i] != '\n' {
+					stripped[i] = ' '
+				}
+			}
+			if i < len(stripped) {
+				stripped[i], stripped[i+1] = ' ', ' '
+				i++
+			}
+		case c == ',':
+			lastComma = i
+		case c == '}' || c == ']':
+			if lastComma >= 0 {
+				stripped[lastComma] = ' '
+			}
+			lastComma = -1
+		case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+			lastComma = -1
+		}
+	}
+	return stripped
+}
@@ -11,8 +11,9 @@ import (
 )
 
 type ProtoEditor struct {
-	xmlFile string
-	docRoot *XmlElement
+	xmlFile       string
+	docRoot       *XmlElement
+	originalBytes []byte
 }
 
 func FindJetBrainsRootAndOpen(findFrom string) (*ProtoEditor, error) {
@@ -39,6 +40,7 @@ func FindJetBrainsRootAndOpen(findFrom string) (*ProtoEditor, error) {
 	protoEditor := &ProtoEditor{xmlFile: filepath.Join(ideaDir, "protoeditor.xml"), docRoot: &XmlElement{}}
 	fileBytes, err := os.ReadFile(protoEditor.xmlFile)
 	if err == nil || os.IsNotExist(err) {
+		protoEditor.originalBytes = fileBytes
 		if err = xml.Unmarshal(fileBytes, protoEditor.docRoot); err != nil && err != io.EOF {
 			return nil, fmt.Errorf("func xml.Unmarshal() error: [%w]", err)
 		}
@@ -158,7 +160,7 @@ func (thisP *ProtoEditor) ConfigProtoPath(goPkg string, protoPaths []string) {
 
 	deleteCount := 0
 	for i := len(pList.Elements) - 1; i >= 0; i-- {
-		if pList.Elements[i].Comment == "" || pList.Elements[i].Comment == goPkg {
+		if pList.Elements[i].Comment == goPkg {
 			pList.Elements[i] = pList.Elements[len(pList.Elements)-1-deleteCount]
 			deleteCount++
 		}
@@ -186,6 +188,7 @@ func (thisP *ProtoEditor) ConfigProtoPath(goPkg string, protoPaths []string) {
 	}
 }
 
+// Save writes protoeditor.xml if it changed.
 func (thisP *ProtoEditor) Save() error {
 	buf := bytes.Buffer{}
 	buf.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
@@ -196,9 +199,13 @@ func (thisP *ProtoEditor) Save() error {
 	if err := encoder.Flush(); err != nil {
 		return fmt.Errorf("func encoder.Flush() error: [%w]", err)
 	}
+	if bytes.Equal(buf.Bytes(), thisP.originalBytes) {
+		return nil
+	}
 	if err := os.WriteFile(thisP.xmlFile, buf.Bytes(), 0644); err != nil {
 		return fmt.Errorf("func os.WriteFile() error: [%w]", err)
 	}
+	thisP.originalBytes = buf.Bytes()
 	return nil
 }
 
@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ProtolsConfig is a protols.toml, of which only config.include_paths items owned by a Go package are changed.
+// Owned items are marked by a "# go-protoc: <pkg>" comment, so include_paths is always written one item per line.
+type ProtolsConfig struct {
+	tomlFile      string
+	lines         []string
+	originalBytes []byte
+}
+
+const protolsOwnerPrefix = "# go-protoc: "
+
+var (
+	protolsStringRegexp = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'[^']*'`)
+	protolsOwnerRegexp  = regexp.MustCompile(`#\s*go-protoc:\s*(\S+)\s*$`)
+)
+
+type protolsIncludePath struct {
+	path  string
+	owner string
+}
+
+// FindProtolsRootAndOpen opens the nearest protols.toml above findFrom, or createIn/protols.toml if there is none.
+func FindProtolsRootAndOpen(findFrom, createIn string) (*ProtolsConfig, error) {
+	rootDir, err := findDirUpward(findFrom, func(dir string) (bool, error) {
+		info, err := os.Stat(filepath.Join(dir, "protols.toml"))
+		if err != nil && !os.IsNotExist(err) {
+			return false, fmt.Errorf("func os.Stat() error: [%w]", err)
+		}
+		return err == nil && !info.IsDir(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rootDir == "" {
+		if rootDir, err = filepath.Abs(createIn); err != nil {
+			return nil, fmt.Errorf("func filepath.Abs() error: [%w]", err)
+		}
+	}
+	protolsConfig := &ProtolsConfig{tomlFile: filepath.Join(rootDir, "protols.toml")}
+	if protolsConfig.originalBytes, err = os.ReadFile(protolsConfig.tomlFile); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("func os.ReadFile() error: [%w]", err)
+	}
+	if len(protolsConfig.originalBytes) > 0 {
+		protolsConfig.lines = strings.Split(strings.TrimSuffix(string(protolsConfig.originalBytes), "\n"), "\n")
+	}
+	return protolsConfig, nil
+}
+
+// ConfigIncludePaths replaces the include_paths items owned by goPkg with includePaths.
+// Items added by hand or owned by another package are left in place.
+func (thisP *ProtolsConfig) ConfigIncludePaths(goPkg string, includePaths []string) error {
+	sectionBegin, sectionEnd := thisP.findSection("config")
+	if sectionBegin < 0 && len(includePaths) == 0 {
+		return nil
+	}
+	if sectionBegin < 0 {
+		if len(thisP.lines) > 0 && strings.TrimSpace(thisP.lines[len(thisP.lines)-1]) != "" {
+			thisP.lines = append(thisP.lines, "")
+		}
+		thisP.lines = append(thisP.lines, "[config]")
+		sectionBegin, sectionEnd = len(thisP.lines)-1, len(thisP.lines)
+	}
+
+	var items []protolsIncludePath
+	arrayBegin, arrayEnd := sectionEnd, sectionEnd
+	for i := sectionBegin + 1; i < sectionEnd; i++ {
+		key, _, ok := strings.Cut(thisP.lines[i], "=")
+		if !ok || strings.TrimSpace(key) != "include_paths" {
+			continue
+		}
+		var err error
+		if items, arrayEnd, err = thisP.parseArray(i, sectionEnd); err != nil {
+			return err
+		}
+		arrayBegin = i
+		break
+	}
+
+	newItems := make([]protolsIncludePath, 0, len(items)+len(includePaths))
+	for _, item := range items {
+		if item.owner != goPkg {
+			newItems = append(newItems, item)
+		}
+	}
+	for _, includePath := range includePaths {
+		includePath = thisP.configPath(includePath)
+		exists := false
+		for _, item := range newItems {
+			exists = exists || item.path == includePath
+		}
+		if !exists {
+			newItems = append(newItems, protolsIncludePath{path: includePath, owner: goPkg})
+		}
+	}
+	if equalProtolsIncludePaths(items, newItems) {
+		return nil
+	}
+
+	arrayLines := []string{"include_paths = ["}
+	for _, item := range newItems {
+		line := "    " + strconv.Quote(item.path) + ","
+		if item.owner != "" {
+			line += " " + protolsOwnerPrefix + item.owner
+		}
+		arrayLines = append(arrayLines, line)
+	}
+	arrayLines = append(arrayLines, "]")
+	if arrayBegin == sectionEnd {
+		arrayBegin, arrayEnd = sectionBegin+1, sectionBegin+1
+	}
+	thisP.lines = append(thisP.lines[:arrayBegin], append(arrayLines, thisP.lines[arrayEnd:]...)...)
+	return nil
+}
+
+// findSection returns the line of the [name] header and the line the next section begins at, or -1 if there is none.
+func (thisP *ProtolsConfig) findSection(name string) (int, int) {
+	begin := -1
+	for i, line := range thisP.lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "[") {
+			continue
+		}
+		if begin >= 0 {
+			return begin, i
+		}
+		if line == "["+name+"]" {
+			begin = i
+		}
+	}
+	if begin < 0 {
+		return -1, -1
+	}
+	return begin, len(thisP.lines)
+}
+
+// parseArray parses the string array assigned at line begin, returning its items and the line after it.
+func (thisP *ProtolsConfig) parseArray(begin, end int) ([]protolsIncludePath, int, error) {
+	var items []protolsIncludePath
+	_, value, _ := strings.Cut(thisP.lines[begin], "=")
+	if !strings.HasPrefix(strings.TrimSpace(value), "[") {
+		return nil, 0, fmt.Errorf("%s:%d: include_paths is not an array", thisP.tomlFile, begin+1)
+	}
+	for i := begin; i < end; i++ {
+		line := thisP.lines[i]
+		if i == begin {
+			line = value
+		}
+		code, comment := line, ""
+		if loc := protolsOwnerRegexp.FindStringSubmatchIndex(line); loc != nil {
+			code, comment = line[:loc[0]], line[loc[2]:loc[3]]
+		}
+		matches := protolsStringRegexp.FindAllString(code, -1)
+		for _, match := range matches {
+			path, err := unquoteTomlString(match)
+			if err != nil {
+				return nil, 0, fmt.Errorf("%s:%d: %w", thisP.tomlFile, i+1, err)
+			}
+			owner := ""
+			if len(matches) == 1 {
+				owner = comment
+			}
+			items = append(items, protolsIncludePath{path: path, owner: owner})
+		}
+		if strings.Contains(protolsStringRegexp.ReplaceAllString(code, ""), "]") {
+			return items, i + 1, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("%s:%d: include_paths array is not closed", thisP.tomlFile, begin+1)
+}
+
+// configPath returns path relative to the dir of protols.toml if it is inside it.
+func (thisP *ProtolsConfig) configPath(path string) string {
+	if rel, err := filepath.Rel(filepath.Dir(thisP.tomlFile), path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(path)
+}
+
+// Save writes the config if it changed.
+func (thisP *ProtolsConfig) Save() error {
+	configBytes := []byte(strings.Join(thisP.lines, "\n") + "\n")
+	if bytes.Equal(configBytes, thisP.originalBytes) || (len(thisP.lines) == 0 && len(thisP.originalBytes) == 0) {
+		return nil
+	}
+	if err := os.WriteFile(thisP.tomlFile, configBytes, 0644); err != nil {
+		return fmt.Errorf("func os.WriteFile() error: [%w]", err)
+	}
+	thisP.originalBytes = configBytes
+	return nil
+}
+
+func equalProtolsIncludePaths(a, b []protolsIncludePath) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func unquoteTomlString(s string) (string, error) {
+	if strings.HasPrefix(s, "'") {
+		return strings.Trim(s, "'"), nil
+	}
+	value, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("unsupported string: [%s]", s)
+	}
+	return value, nil
+}
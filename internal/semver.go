@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareSemver compares two "vMAJOR.MINOR.PATCH[-pre][+build]" versions like golang.org/x/mod/semver.Compare,
+// except that an invalid version sorts before every valid one.
+func CompareSemver(a, b string) int {
+	pa, okA := parseSemver(a)
+	pb, okB := parseSemver(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+	for i := 0; i < 3; i++ {
+		if pa.nums[i] != pb.nums[i] {
+			if pa.nums[i] < pb.nums[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case pa.pre == pb.pre:
+		return 0
+	case pa.pre == "":
+		return 1
+	case pb.pre == "":
+		return -1
+	}
+	return comparePrerelease(pa.pre, pb.pre)
+}
+
+// comparePrerelease compares dot separated identifiers, numeric ones numerically and before alphanumeric ones.
+func comparePrerelease(a, b string) int {
+	idsA, idsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(idsA) && i < len(idsB); i++ {
+		if idsA[i] == idsB[i] {
+			continue
+		}
+		numA, errA := strconv.Atoi(idsA[i])
+		numB, errB := strconv.Atoi(idsB[i])
+		switch {
+		case errA == nil && errB == nil:
+			if numA < numB {
+				return -1
+			}
+			return 1
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		case idsA[i] < idsB[i]:
+			return -1
+		default:
+			return 1
+		}
+	}
+	switch {
+	case len(idsA) < len(idsB):
+		return -1
+	case len(idsA) > len(idsB):
+		return 1
+	}
+	return 0
+}
+
+type semver struct {
+	nums [3]int
+	pre  string
+}
+
+func parseSemver(v string) (semver, bool) {
+	if !strings.HasPrefix(v, "v") {
+		return semver{}, false
+	}
+	v, _, _ = strings.Cut(v[1:], "+")
+	v, pre, _ := strings.Cut(v, "-")
+	parts := strings.Split(v, ".")
+	if len(parts) > 3 {
+		return semver{}, false
+	}
+	parsed := semver{pre: pre}
+	for i, part := range parts {
+		num, err := strconv.Atoi(part)
+		if err != nil || num < 0 {
+			return semver{}, false
+		}
+		parsed.nums[i] = num
+	}
+	return parsed, true
+}
@@ -0,0 +1,33 @@
+package internal
+
+import "testing"
+
+func TestCompareSemver(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"v1.2.3", "v1.2.4", -1},
+		{"v1.10.0", "v1.9.0", 1},
+		{"v2.0.0", "v1.99.99", 1},
+		{"v1.2", "v1.2.0", 0},
+		{"v1.2.3+build", "v1.2.3", 0},
+		{"v1.0.0-rc.1", "v1.0.0", -1},
+		{"v1.0.0-alpha", "v1.0.0-beta", -1},
+		{"v1.0.0-rc.9", "v1.0.0-rc.10", -1},
+		{"v1.0.0-1", "v1.0.0-alpha", -1},
+		{"v1.0.0-alpha", "v1.0.0-alpha.1", -1},
+		{"1.2.3", "v0.0.1", -1},
+		{"v1.2.3.4", "v0.0.1", -1},
+		{"bad", "worse", 0},
+	}
+	for _, test := range tests {
+		if got := CompareSemver(test.a, test.b); got != test.want {
+			t.Errorf("CompareSemver(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+		if got := CompareSemver(test.b, test.a); got != -test.want {
+			t.Errorf("CompareSemver(%q, %q) = %d, want %d", test.b, test.a, got, -test.want)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// VSCodeSettings is a .vscode/settings.json, of which only protoc.options entries owned by a Go package are changed.
+// Owned entries are recorded per package in .vscode/go-protoc-owned.json, since VS Code flags unknown settings.
+// Settings with comments or trailing commas are read but never rewritten, a change is returned as an error instead.
+type VSCodeSettings struct {
+	jsonFile           string
+	ownedFile          string
+	workspaceDir       string
+	settings           *jsonObject
+	owned              map[string][]string
+	originalBytes      []byte
+	originalOwnedBytes []byte
+	jsonc              bool
+}
+
+// vsCodeLegacyOwnedKey is the top-level setting owned entries used to be recorded under, moved to the owned file on Save.
+const vsCodeLegacyOwnedKey = "go-protoc.protoPaths"
+
+// FindVSCodeRootAndOpen opens the settings of the nearest .vscode dir above findFrom, or of createIn/.vscode if there is none.
+func FindVSCodeRootAndOpen(findFrom, createIn string) (*VSCodeSettings, error) {
+	workspaceDir, err := findDirUpward(findFrom, func(dir string) (bool, error) {
+		return isDir(filepath.Join(dir, ".vscode"))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if workspaceDir == "" {
+		if workspaceDir, err = filepath.Abs(createIn); err != nil {
+			return nil, fmt.Errorf("func filepath.Abs() error: [%w]", err)
+		}
+	}
+	vsCodeSettings := &VSCodeSettings{
+		jsonFile:     filepath.Join(workspaceDir, ".vscode", "settings.json"),
+		ownedFile:    filepath.Join(workspaceDir, ".vscode", "go-protoc-owned.json"),
+		workspaceDir: workspaceDir,
+		owned:        map[string][]string{},
+	}
+	if vsCodeSettings.originalBytes, err = os.ReadFile(vsCodeSettings.jsonFile); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("func os.ReadFile() error: [%w]", err)
+	}
+	strippedBytes := stripJSONC(vsCodeSettings.originalBytes)
+	vsCodeSettings.jsonc = !bytes.Equal(strippedBytes, vsCodeSettings.originalBytes)
+	if vsCodeSettings.settings, err = parseJSONObject(strippedBytes); err != nil {
+		return nil, fmt.Errorf("parse [%s] error: [%w]", vsCodeSettings.jsonFile, err)
+	}
+	if vsCodeSettings.originalOwnedBytes, err = os.ReadFile(vsCodeSettings.ownedFile); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("func os.ReadFile() error: [%w]", err)
+	}
+	if len(bytes.TrimSpace(vsCodeSettings.originalOwnedBytes)) > 0 {
+		if err = json.Unmarshal(vsCodeSettings.originalOwnedBytes, &vsCodeSettings.owned); err != nil {
+			return nil, fmt.Errorf("parse [%s] error: [%w]", vsCodeSettings.ownedFile, err)
+		}
+	} else if _, err = vsCodeSettings.settings.get(vsCodeLegacyOwnedKey, &vsCodeSettings.owned); err != nil {
+		return nil, err
+	}
+	vsCodeSettings.settings.delete(vsCodeLegacyOwnedKey)
+	return vsCodeSettings, nil
+}
+
+// ConfigProtoPath replaces the --proto_path entries of protoc.options owned by goPkg with protoPaths.
+// Entries also owned by another package or added by hand are left in place.
+func (thisP *VSCodeSettings) ConfigProtoPath(goPkg string, protoPaths []string) error {
+	owned := thisP.owned
+	protoc := &jsonObject{values: map[string]json.RawMessage{}}
+	if _, err := thisP.settings.get("protoc", protoc); err != nil {
+		return err
+	}
+	var options []string
+	if _, err := protoc.get("options", &options); err != nil {
+		return err
+	}
+
+	ownedByOthers := map[string]bool{}
+	for pkg, pkgOptions := range owned {
+		if pkg == goPkg {
+			continue
+		}
+		for _, option := range pkgOptions {
+			ownedByOthers[option] = true
+		}
+	}
+	removing := map[string]bool{}
+	for _, option := range owned[goPkg] {
+		if !ownedByOthers[option] {
+			removing[option] = true
+		}
+	}
+	newOptions := make([]string, 0, len(options)+len(protoPaths))
+	for _, option := range options {
+		if !removing[option] {
+			newOptions = append(newOptions, option)
+		}
+	}
+	var pkgOptions []string
+	for _, protoPath := range protoPaths {
+		option := "--proto_path=" + thisP.workspacePath(protoPath)
+		if containsString(newOptions, option) {
+			if ownedByOthers[option] {
+				pkgOptions = appendUnique(pkgOptions, option)
+			}
+			continue
+		}
+		newOptions = append(newOptions, option)
+		pkgOptions = append(pkgOptions, option)
+	}
+
+	if len(pkgOptions) > 0 {
+		owned[goPkg] = pkgOptions
+	} else {
+		delete(owned, goPkg)
+	}
+	if len(newOptions) == 0 && len(options) == 0 {
+		return nil
+	}
+	if err := protoc.set("options", newOptions); err != nil {
+		return err
+	}
+	return thisP.settings.set("protoc", protoc)
+}
+
+// workspacePath returns path relative to ${workspaceFolder} if it is inside the workspace dir.
+func (thisP *VSCodeSettings) workspacePath(path string) string {
+	if rel, err := filepath.Rel(thisP.workspaceDir, path); err == nil && rel == "." {
+		return "${workspaceFolder}"
+	} else if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "${workspaceFolder}/" + filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(path)
+}
+
+// Save writes the settings if they changed other than in formatting, then the owned file.
+// Settings with comments or trailing commas are left untouched, the error returned lists the protoc.options to set by hand.
+func (thisP *VSCodeSettings) Save() error {
+	compactBytes, err := thisP.settings.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	originalCompact := bytes.Buffer{}
+	if strippedBytes := stripJSONC(thisP.originalBytes); len(bytes.TrimSpace(strippedBytes)) == 0 {
+		originalCompact.WriteString("{}")
+	} else if err = json.Compact(&originalCompact, strippedBytes); err != nil {
+		return fmt.Errorf("func json.Compact() error: [%w]", err)
+	}
+	if !bytes.Equal(compactBytes, originalCompact.Bytes()) {
+		if thisP.jsonc {
+			protoc := &jsonObject{values: map[string]json.RawMessage{}}
+			if _, err = thisP.settings.get("protoc", protoc); err != nil {
+				return err
+			}
+			return fmt.Errorf("[%s] has comments or trailing commas and is left untouched, set \"protoc\": {\"options\": %s} by hand", thisP.jsonFile, protoc.values["options"])
+		}
+		settingsBytes, err := thisP.settings.marshalIndent("    ")
+		if err != nil {
+			return err
+		}
+		if err = os.MkdirAll(filepath.Dir(thisP.jsonFile), 0755); err != nil {
+			return fmt.Errorf("func os.MkdirAll() error: [%w]", err)
+		}
+		if err = os.WriteFile(thisP.jsonFile, settingsBytes, 0644); err != nil {
+			return fmt.Errorf("func os.WriteFile() error: [%w]", err)
+		}
+		thisP.originalBytes = settingsBytes
+	}
+	return thisP.saveOwned()
+}
+
+// saveOwned writes the owned file if it changed, removing it once no package owns an entry.
+func (thisP *VSCodeSettings) saveOwned() error {
+	if len(thisP.owned) == 0 {
+		if len(thisP.originalOwnedBytes) == 0 {
+			return nil
+		}
+		if err := os.Remove(thisP.ownedFile); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("func os.Remove() error: [%w]", err)
+		}
+		thisP.originalOwnedBytes = nil
+		return nil
+	}
+	ownedBytes, err := json.MarshalIndent(thisP.owned, "", "    ")
+	if err != nil {
+		return fmt.Errorf("func json.MarshalIndent() error: [%w]", err)
+	}
+	ownedBytes = append(ownedBytes, '\n')
+	if bytes.Equal(ownedBytes, thisP.originalOwnedBytes) {
+		return nil
+	}
+	if err = os.MkdirAll(filepath.Dir(thisP.ownedFile), 0755); err != nil {
+		return fmt.Errorf("func os.MkdirAll() error: [%w]", err)
+	}
+	if err = os.WriteFile(thisP.ownedFile, ownedBytes, 0644); err != nil {
+		return fmt.Errorf("func os.WriteFile() error: [%w]", err)
+	}
+	thisP.originalOwnedBytes = ownedBytes
+	return nil
+}
+
+// findDirUpward returns the first dir from findFrom up to the root matching test, or "" if none does.
+func findDirUpward(findFrom string, test func(dir string) (bool, error)) (string, error) {
+	findFrom, err := filepath.Abs(findFrom)
+	if err != nil {
+		return "", fmt.Errorf("func filepath.Abs() error: [%w]", err)
+	}
+	for {
+		if ok, err := test(findFrom); err != nil {
+			return "", err
+		} else if ok {
+			return findFrom, nil
+		}
+		nextFindFrom := filepath.Dir(findFrom)
+		if nextFindFrom == findFrom {
+			return "", nil
+		}
+		findFrom = nextFindFrom
+	}
+}
+
+func isDir(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("func os.Stat() error: [%w]", err)
+	}
+	return info.IsDir(), nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(values []string, value string) []string {
+	if containsString(values, value) {
+		return values
+	}
+	return append(values, value)
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStripJSONC(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "plain", data: `{"a": [1, 2], "b": "x"}`, want: `{"a": [1, 2], "b": "x"}`},
+		{name: "line comment", data: "{\n// c\n\"a\": 1 // d\n}", want: "{\n    \n\"a\": 1     \n}"},
+		{name: "block comment", data: "{/* c\n*/\"a\": 1}", want: "{    \n  \"a\": 1}"},
+		{name: "trailing commas", data: `{"a": [1, 2,], "b": 3, }`, want: `{"a": [1, 2 ], "b": 3  }`},
+		{name: "trailing comma before a comment", data: "{\"a\": 1, // c\n}", want: "{\"a\": 1      \n}"},
+		{name: "comment markers and commas in strings", data: `{"a": "// x /* y */ ,}", "b": "\",]"}`, want: `{"a": "// x /* y */ ,}", "b": "\",]"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(stripJSONC([]byte(test.data))); got != test.want {
+				t.Errorf("stripJSONC() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestVSCodeSettings(t *testing.T) {
+	workspaceDir := t.TempDir()
+	settingsFile := filepath.Join(workspaceDir, ".vscode", "settings.json")
+	ownedFile := filepath.Join(workspaceDir, ".vscode", "go-protoc-owned.json")
+	configure := func(goPkg string, protoPaths ...string) error {
+		vsCodeSettings, err := FindVSCodeRootAndOpen(workspaceDir, workspaceDir)
+		if err != nil {
+			return err
+		}
+		if err = vsCodeSettings.ConfigProtoPath(goPkg, protoPaths); err != nil {
+			return err
+		}
+		return vsCodeSettings.Save()
+	}
+	readFile := func(file string) string {
+		data, err := os.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatalf("os.ReadFile() error: %v", err)
+		}
+		return string(data)
+	}
+
+	if err := configure("example.com/a", filepath.Join(workspaceDir, "proto")); err != nil {
+		t.Fatalf("configure() error: %v", err)
+	}
+	if got := readFile(settingsFile); !strings.Contains(got, `"--proto_path=${workspaceFolder}/proto"`) || strings.Contains(got, "go-protoc") {
+		t.Errorf("settings.json = %s", got)
+	}
+	if got := readFile(ownedFile); !strings.Contains(got, `"example.com/a"`) {
+		t.Errorf("go-protoc-owned.json = %s", got)
+	}
+
+	// an unchanged JSONC file is accepted and left as is
+	jsonc := "{\n    // protoc\n    \"protoc\": {\"options\": [\"--proto_path=${workspaceFolder}/proto\",]},\n}\n"
+	if err := os.WriteFile(settingsFile, []byte(jsonc), 0644); err != nil {
+		t.Fatalf("os.WriteFile() error: %v", err)
+	}
+	if err := configure("example.com/a", filepath.Join(workspaceDir, "proto")); err != nil {
+		t.Fatalf("configure() unchanged JSONC error: %v", err)
+	}
+	if err := configure("example.com/a", filepath.Join(workspaceDir, "other")); err == nil || !strings.Contains(err.Error(), "by hand") {
+		t.Errorf("configure() changed JSONC error = %v, want the options to set by hand", err)
+	}
+	if got := readFile(settingsFile); got != jsonc {
+		t.Errorf("settings.json with comments was rewritten: %s", got)
+	}
+
+	// ownership recorded under the legacy key moves to the owned file
+	if err := os.Remove(ownedFile); err != nil {
+		t.Fatalf("os.Remove() error: %v", err)
+	}
+	legacy := `{"go-protoc.protoPaths": {"example.com/a": ["--proto_path=${workspaceFolder}/proto"]}, "protoc": {"options": ["--proto_path=${workspaceFolder}/proto"]}}`
+	if err := os.WriteFile(settingsFile, []byte(legacy), 0644); err != nil {
+		t.Fatalf("os.WriteFile() error: %v", err)
+	}
+	if err := configure("example.com/a"); err != nil {
+		t.Fatalf("configure() legacy error: %v", err)
+	}
+	if got := readFile(settingsFile); strings.Contains(got, "go-protoc") || strings.Contains(got, "--proto_path") {
+		t.Errorf("settings.json = %s", got)
+	}
+	if got := readFile(ownedFile); got != "" {
+		t.Errorf("go-protoc-owned.json = %s, want removed", got)
+	}
+}
@@ -0,0 +1,51 @@
+package goprotoc
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// protocInvocation is everything Run passes to protoc, independent of the Backend running it.
+type protocInvocation struct {
+	protoPaths    []string
+	plugins       []*pluginInvocation
+	protoFiles    []string
+	moduleDir     string         // dir of the module owning the generated files
+	outDir        string         // staging dir under moduleDir, or a temp dir in Check mode
+	descriptorSet *DescriptorSet // nil if this invocation writes no descriptor set
+	extraArgs     []string       // ExtraOutputs and CustomProtocOpts Run does not merge
+}
+
+type pluginInvocation struct {
+	name string
+	path string
+	out  string
+	opts []string
+}
+
+func (thisP *protocInvocation) args() []string {
+	args := make([]string, 0, len(thisP.protoPaths)+len(thisP.plugins)*3+len(thisP.protoFiles))
+	for _, protoPath := range thisP.protoPaths {
+		args = append(args, fmt.Sprintf("--proto_path=%s", protoPath))
+	}
+	for _, plugin := range thisP.plugins {
+		args = append(args, fmt.Sprintf("--%s_out=%s", plugin.name, plugin.out))
+		for _, opt := range plugin.opts {
+			args = append(args, fmt.Sprintf("--%s_opt=%s", plugin.name, opt))
+		}
+		args = append(args, fmt.Sprintf("--plugin=protoc-gen-%s=%s", plugin.name, plugin.path))
+	}
+	if thisP.descriptorSet != nil {
+		args = append(args, thisP.descriptorSet.protocArgs(thisP.outDir)...)
+	}
+	args = append(args, thisP.extraArgs...)
+	return append(args, thisP.protoFiles...)
+}
+
+func (thisP *protocInvocation) argsFileBytes() []byte {
+	buf := bytes.Buffer{}
+	for _, arg := range thisP.args() {
+		_, _ = buf.WriteString(arg + "\n")
+	}
+	return buf.Bytes()
+}
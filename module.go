@@ -0,0 +1,278 @@
+package goprotoc
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sky91/go-protoc/internal"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PackageResult is the outcome of one package generated by RunModule.
+type PackageResult struct {
+	ImportPath string
+	Dir        string
+	Deps       []string // import paths of module packages used as proto_path, generated before this one
+	Duration   time.Duration
+	Err        error
+}
+
+// sharedPreparation is the protoc and plugin preparation RunModule does once for all packages.
+type sharedPreparation struct {
+	pluginInstallDirs map[string]string // plugin name -> install dir, "" if not enabled
+	ideMtx            sync.Mutex
+	buildListOnce     sync.Once
+	buildList         []*internal.ModulePublic
+	buildListErr      error
+}
+
+func (thisP *sharedPreparation) pluginInstallDir(name string) (string, bool) {
+	if thisP == nil {
+		return "", false
+	}
+	installDir, ok := thisP.pluginInstallDirs[name]
+	return installDir, ok
+}
+
+// listBuildListMods lists the build list once for all packages.
+func (thisP *sharedPreparation) listBuildListMods() ([]*internal.ModulePublic, error) {
+	if thisP == nil {
+		return listBuildListMods()
+	}
+	thisP.buildListOnce.Do(func() {
+		thisP.buildList, thisP.buildListErr = listBuildListMods()
+	})
+	return thisP.buildList, thisP.buildListErr
+}
+
+// lockIDE serializes IDE config updates of packages generated in parallel.
+func (thisP *sharedPreparation) lockIDE() (unlock func()) {
+	if thisP == nil {
+		return func() {}
+	}
+	thisP.ideMtx.Lock()
+	return thisP.ideMtx.Unlock
+}
+
+// modulePackage is a package with a proto dir found by RunModule.
+type modulePackage struct {
+	genFilePkg    *internal.PackagePublic
+	genPkg        *internal.PackagePublic
+	importPkgDirs map[string]string
+	deps          []int
+	err           error
+}
+
+// RunModule generates every package with a proto dir in the main module, or in every module of the go.work workspace.
+// Packages are generated after the packages they import for proto_path, at most Parallelism at once,
+// with protoc and plugins prepared once. The settings of thisP apply to all packages; ProtoDir must be relative.
+func (thisP *Generator) RunModule(ctx context.Context) ([]PackageResult, error) {
+	if err := thisP.Backend.validate(); err != nil {
+		return nil, err
+	}
+	pkgs, err := thisP.discoverModulePackages()
+	if err != nil {
+		return nil, errors.Wrapf(err, "discoverModulePackages() error")
+	}
+	if pkgs, err = sortModulePackages(pkgs); err != nil {
+		return nil, errors.Wrapf(err, "sortModulePackages() error")
+	}
+	thisP.Logger.Infof("module packages found: count=[%d]", len(pkgs))
+
+	generator := *thisP
+	generator.shared = &sharedPreparation{pluginInstallDirs: map[string]string{}}
+	if generator.getBackend() == BackendProtoc {
+		if err = generator.prepareProtoc(ctx); err != nil {
+			return nil, errors.Wrapf(err, "prepareProtoc() error")
+		}
+	}
+	for _, plugin := range generator.getPlugins() {
+		installDir, temporary, err := generator.preparePlugin(ctx, plugin)
+		if err != nil {
+			return nil, errors.Wrapf(err, "preparePlugin() error: plugin=[%s]", plugin.getName())
+		}
+		if temporary {
+			defer func() { _ = os.RemoveAll(installDir) }()
+		}
+		generator.shared.pluginInstallDirs[plugin.getName()] = installDir
+	}
+
+	results := make([]PackageResult, len(pkgs))
+	done := make([]chan struct{}, len(pkgs))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	semaphore := make(chan struct{}, thisP.getParallelism())
+	wg := sync.WaitGroup{}
+	for i, pkg := range pkgs {
+		i, pkg := i, pkg
+		results[i] = PackageResult{ImportPath: pkg.genPkg.ImportPath, Dir: pkg.genPkg.Dir}
+		for _, dep := range pkg.deps {
+			results[i].Deps = append(results[i].Deps, pkgs[dep].genPkg.ImportPath)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[i])
+			for _, dep := range pkg.deps {
+				<-done[dep]
+				if results[dep].Err != nil {
+					results[i].Err = fmt.Errorf("dependency failed: [%s]", results[dep].ImportPath)
+					return
+				}
+			}
+			if pkg.err != nil {
+				results[i].Err = pkg.err
+				return
+			}
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				results[i].Err = ctx.Err()
+				return
+			}
+			defer func() { <-semaphore }()
+			begin := time.Now()
+			results[i].Err = generator.runModulePackage(ctx, pkg)
+			results[i].Duration = time.Since(begin)
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			thisP.Logger.Errorf("package failed: [%s], duration=[%s], err=[%v]", result.ImportPath, result.Duration, result.Err)
+		} else {
+			thisP.Logger.Infof("package ok: [%s], duration=[%s]", result.ImportPath, result.Duration)
+		}
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("generation failed for %d of %d packages", failed, len(results))
+	}
+	return results, nil
+}
+
+func (thisP *Generator) runModulePackage(ctx context.Context, pkg *modulePackage) error {
+	gen, err := thisP.preparePackageGeneration(ctx, pkg.genFilePkg, pkg.genPkg, pkg.importPkgDirs)
+	if err != nil {
+		return errors.Wrapf(err, "preparePackageGeneration() error")
+	}
+	defer gen.close()
+	return thisP.runGeneration(gen)
+}
+
+func (thisP *Generator) discoverModulePackages() ([]*modulePackage, error) {
+	if filepath.IsAbs(thisP.getProtoDir()) {
+		return nil, fmt.Errorf("ProtoDir must be relative to the package dir: [%s]", thisP.getProtoDir())
+	}
+	mods, cmd, err := internal.GoListMainMods()
+	if err != nil {
+		return nil, errors.Wrapf(err, "GoListMainMods() error: cmd=[%+v]", cmd)
+	}
+	thisP.Logger.Infof("GoListMainMods() ok: cmd=[%+v]", cmd)
+
+	var pkgs []*modulePackage
+	pkgIndexes := map[string]int{}
+	for _, mod := range mods {
+		if mod.Dir == "" {
+			continue
+		}
+		goPkgs, cmd, err := internal.GoListPkgs(filepath.Join(mod.Dir, "..."), nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GoListPkgs() error: cmd=[%+v]", cmd)
+		}
+		thisP.Logger.Infof("GoListPkgs() ok: cmd=[%+v]", cmd)
+		for _, goPkg := range goPkgs {
+			if goPkg.Dir == "" {
+				continue
+			}
+			if info, err := os.Stat(thisP.getProtoDirAbs(goPkg.Dir)); err != nil || !info.IsDir() {
+				continue
+			}
+			pkg := &modulePackage{genPkg: goPkg, genFilePkg: thisP.findGenFilePkg(goPkg)}
+			if goPkg.Error != nil && (pkg.genFilePkg == nil || goPkg.Module == nil) {
+				pkg.err = fmt.Errorf("GoListPkgs() error: pkg=[%s], pkg.Error=[%+v]", goPkg.ImportPath, goPkg.Error)
+			}
+			if pkg.genFilePkg == nil {
+				pkg.genFilePkg = &internal.PackagePublic{Dir: goPkg.Dir, ImportPath: goPkg.ImportPath, Name: goPkg.Name, Module: goPkg.Module}
+			}
+			pkgIndexes[goPkg.Dir] = len(pkgs)
+			pkgs = append(pkgs, pkg)
+		}
+	}
+
+	for _, pkg := range pkgs {
+		if pkg.err != nil {
+			continue
+		}
+		if pkg.importPkgDirs, err = listImportPathDir(pkg.genFilePkg.Imports); err != nil {
+			pkg.err = errors.Wrapf(err, "listImportPathDir() error")
+			continue
+		}
+		for _, dir := range sortedKeys(pkg.importPkgDirs) {
+			if i, ok := pkgIndexes[dir]; ok {
+				pkg.deps = append(pkg.deps, i)
+			}
+		}
+	}
+	return pkgs, nil
+}
+
+// sortModulePackages orders pkgs so every package comes after its deps, and remaps deps to the new order.
+func sortModulePackages(pkgs []*modulePackage) ([]*modulePackage, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make([]int, len(pkgs))
+	newIndexes := make([]int, len(pkgs))
+	sorted := make([]*modulePackage, 0, len(pkgs))
+	var visit func(i int, path []string) error
+	visit = func(i int, path []string) error {
+		path = append(path, pkgs[i].genPkg.ImportPath)
+		switch states[i] {
+		case visiting:
+			return fmt.Errorf("import cycle: [%s]", strings.Join(path, " -> "))
+		case visited:
+			return nil
+		}
+		states[i] = visiting
+		sort.Ints(pkgs[i].deps)
+		for _, dep := range pkgs[i].deps {
+			if err := visit(dep, path); err != nil {
+				return err
+			}
+		}
+		states[i] = visited
+		newIndexes[i] = len(sorted)
+		sorted = append(sorted, pkgs[i])
+		return nil
+	}
+	for i := range pkgs {
+		if err := visit(i, nil); err != nil {
+			return nil, err
+		}
+	}
+	for _, pkg := range sorted {
+		for j, dep := range pkg.deps {
+			pkg.deps[j] = newIndexes[dep]
+		}
+	}
+	return sorted, nil
+}
+
+func (thisP *Generator) getParallelism() int {
+	if thisP.Parallelism > 0 {
+		return thisP.Parallelism
+	}
+	return runtime.GOMAXPROCS(0)
+}
@@ -0,0 +1,156 @@
+package goprotoc
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sky91/go-protoc/internal"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func (thisP *Generator) isOffline() bool {
+	if thisP.Offline {
+		return true
+	}
+	offline, _ := strconv.ParseBool(os.Getenv(envOffline))
+	return offline
+}
+
+func (thisP *Generator) getProtocLocalPath() string {
+	if thisP.ProtocLocalPath != "" {
+		return thisP.ProtocLocalPath
+	}
+	return os.Getenv(envProtocLocalPath)
+}
+
+// getProtocLocalDir reports whether an offline protoc local path points at an extracted distribution.
+func (thisP *Generator) getProtocLocalDir() (string, bool, error) {
+	localPath := thisP.getProtocLocalPath()
+	if !thisP.isOffline() || localPath == "" {
+		return "", false, nil
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return "", false, fmt.Errorf("offline mode, protoc local path not found: [%s], err=[%w]", localPath, err)
+	}
+	if !info.IsDir() {
+		return "", false, nil
+	}
+	localDir, err := filepath.Abs(localPath)
+	if err != nil {
+		return "", false, errors.Wrapf(err, "filepath.Abs() error")
+	}
+	return localDir, true, nil
+}
+
+// readProtocZipOffline returns nil zipFileBytes when an already extracted protoc can be used as is.
+func (thisP *Generator) readProtocZipOffline(cacheZipFile string) (zipFile string, zipFileBytes []byte, err error) {
+	protocDistPath, err := thisP.getProtocDistPath()
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "getProtocDistPath() error")
+	}
+
+	if localPath := thisP.getProtocLocalPath(); localPath != "" {
+		if _, isDir, err := thisP.getProtocLocalDir(); err != nil {
+			return "", nil, errors.Wrapf(err, "getProtocLocalDir() error")
+		} else if isDir {
+			if _, err = os.Stat(getProtocBinPath(protocDistPath)); err != nil {
+				return "", nil, fmt.Errorf("offline mode, protoc binary not found, expected: [%s]", getProtocBinPath(protocDistPath))
+			}
+			if err = thisP.verifySeededProtocDist(protocDistPath); err != nil {
+				return "", nil, errors.Wrapf(err, "verifySeededProtocDist() error")
+			}
+			thisP.Logger.Infof("offline mode, use protoc dir: [%s]", protocDistPath)
+			return "", nil, nil
+		}
+		if zipFileBytes, err = os.ReadFile(localPath); err != nil {
+			return "", nil, errors.Wrapf(err, "os.ReadFile() error")
+		}
+		return localPath, zipFileBytes, nil
+	}
+
+	zipFileBytes, err = os.ReadFile(cacheZipFile)
+	if err == nil && len(zipFileBytes) >= 1024*1024 {
+		return cacheZipFile, zipFileBytes, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", nil, errors.Wrapf(err, "os.ReadFile() error")
+	}
+	if _, err = os.Stat(getProtocBinPath(protocDistPath)); err == nil {
+		if err = thisP.verifySeededProtocDist(protocDistPath); err != nil {
+			return "", nil, errors.Wrapf(err, "verifySeededProtocDist() error")
+		}
+		thisP.Logger.Infof("offline mode, use seeded protoc dir: [%s]", protocDistPath)
+		return "", nil, nil
+	}
+	downloadUrl, err := thisP.getProtocDownloadUrl()
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "getProtocDownloadUrl() error")
+	}
+	return "", nil, fmt.Errorf("offline mode, protoc not found, expected zip [%s] (from [%s]) or binary [%s]; "+
+		"seed the cache or set Generator.ProtocLocalPath / %s to a protoc zip or dir",
+		cacheZipFile, downloadUrl, getProtocBinPath(protocDistPath), envProtocLocalPath)
+}
+
+// verifySeededProtocDist checks an extracted protoc dir used without its zip, as the online path checks the zip:
+// the sha256 of the archive recorded in its dist manifest must match the pin and the files must be intact.
+// A dir without a dist manifest, e.g. a protoc install, can only be used with AllowUnpinned.
+func (thisP *Generator) verifySeededProtocDist(protocDistPath string) error {
+	manifestPath := getProtocDistManifestPath(protocDistPath)
+	manifest, err := readProtocDistManifest(manifestPath)
+	if err != nil {
+		return errors.Wrapf(err, "readProtocDistManifest() error")
+	}
+	if manifest == nil {
+		if !thisP.AllowUnpinned {
+			return fmt.Errorf("offline mode, protoc dir [%s] has no dist manifest [%s] to verify it, "+
+				"seed the protoc zip instead or set AllowUnpinned", protocDistPath, manifestPath)
+		}
+		thisP.Logger.Errorf("offline mode, protoc dir has no dist manifest, AllowUnpinned set, run it unverified: [%s]", protocDistPath)
+		return nil
+	}
+	if err = thisP.verifyProtocZip(manifestPath, manifest.ArchiveSHA256); err != nil {
+		return errors.Wrapf(err, "verifyProtocZip() error")
+	}
+	if !thisP.isProtocDistIntact(protocDistPath, manifest.ArchiveSHA256) {
+		return fmt.Errorf("offline mode, protoc dir [%s] does not match its dist manifest [%s]", protocDistPath, manifestPath)
+	}
+	return nil
+}
+
+func (thisP *Generator) getGoCmdEnv() []string {
+	if !thisP.isOffline() {
+		return nil
+	}
+	// -mod=mod is rejected in workspace mode
+	if goWork, err := internal.GoEnv("GOWORK"); err == nil && goWork != "" && goWork != "off" {
+		return []string{"GOPROXY=off"}
+	}
+	// the env var overrides the whole GOFLAGS, keep what the user set in the environment or go env -w
+	goFlags, err := internal.GoEnv("GOFLAGS")
+	if err != nil {
+		goFlags = os.Getenv("GOFLAGS")
+	}
+	return []string{"GOFLAGS=" + mergeGoFlags(goFlags, "-mod=mod"), "GOPROXY=off"}
+}
+
+// mergeGoFlags appends flag to the GOFLAGS value goFlags, unless goFlags already sets the same flag.
+func mergeGoFlags(goFlags, flag string) string {
+	name, _, _ := strings.Cut(flag, "=")
+	for _, existing := range strings.Fields(goFlags) {
+		if existingName, _, _ := strings.Cut(existing, "="); existingName == name || existingName == "-"+name {
+			return goFlags
+		}
+	}
+	if goFlags = strings.TrimSpace(goFlags); goFlags == "" {
+		return flag
+	}
+	return goFlags + " " + flag
+}
+
+const (
+	envOffline         = "GO_PROTOC_OFFLINE"
+	envProtocLocalPath = "GO_PROTOC_PROTOC_PATH"
+)
@@ -0,0 +1,80 @@
+package goprotoc
+
+import (
+	"encoding/json"
+	"github.com/sky91/go-protoc/internal"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMergeGoFlags(t *testing.T) {
+	tests := []struct {
+		goFlags string
+		want    string
+	}{
+		{goFlags: "", want: "-mod=mod"},
+		{goFlags: "-tags=integration", want: "-tags=integration -mod=mod"},
+		{goFlags: " -trimpath  -buildvcs=false ", want: "-trimpath  -buildvcs=false -mod=mod"},
+		{goFlags: "-mod=vendor -trimpath", want: "-mod=vendor -trimpath"},
+		{goFlags: "--mod=readonly", want: "--mod=readonly"},
+		{goFlags: "-modfile=go.alt.mod", want: "-modfile=go.alt.mod -mod=mod"},
+	}
+	for _, test := range tests {
+		if got := mergeGoFlags(test.goFlags, "-mod=mod"); got != test.want {
+			t.Errorf("mergeGoFlags(%q) = %q, want %q", test.goFlags, got, test.want)
+		}
+	}
+}
+
+func TestVerifySeededProtocDist(t *testing.T) {
+	osArch, err := protocOsArch()
+	if err != nil {
+		t.Fatalf("protocOsArch() error: %v", err)
+	}
+	archiveSHA256 := strings.Repeat("ab", 32)
+	tests := []struct {
+		name          string
+		manifest      *protocDistManifest
+		protocSize    int
+		pinned        string
+		allowUnpinned bool
+		wantErr       string
+	}{
+		{name: "verified", manifest: &protocDistManifest{ArchiveSHA256: archiveSHA256, Files: []protocDistManifestFile{{Name: "bin/protoc", Size: 4}}}, protocSize: 4, pinned: archiveSHA256},
+		{name: "no manifest", protocSize: 4, pinned: archiveSHA256, wantErr: "no dist manifest"},
+		{name: "no manifest, unpinned allowed", protocSize: 4, allowUnpinned: true},
+		{name: "checksum mismatch", manifest: &protocDistManifest{ArchiveSHA256: archiveSHA256, Files: []protocDistManifestFile{{Name: "bin/protoc", Size: 4}}}, protocSize: 4, pinned: strings.Repeat("cd", 32), wantErr: "checksum mismatch"},
+		{name: "not pinned", manifest: &protocDistManifest{ArchiveSHA256: archiveSHA256, Files: []protocDistManifestFile{{Name: "bin/protoc", Size: 4}}}, protocSize: 4, wantErr: "no pinned sha256"},
+		{name: "file changed", manifest: &protocDistManifest{ArchiveSHA256: archiveSHA256, Files: []protocDistManifestFile{{Name: "bin/protoc", Size: 4}}}, protocSize: 5, pinned: archiveSHA256, wantErr: "does not match its dist manifest"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			protocDistPath := filepath.Join(t.TempDir(), "dist")
+			if err := os.MkdirAll(filepath.Join(protocDistPath, "bin"), 0755); err != nil {
+				t.Fatalf("os.MkdirAll() error: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(protocDistPath, "bin", "protoc"), make([]byte, test.protocSize), 0755); err != nil {
+				t.Fatalf("os.WriteFile() error: %v", err)
+			}
+			if test.manifest != nil {
+				manifestBytes, err := json.Marshal(test.manifest)
+				if err != nil {
+					t.Fatalf("json.Marshal() error: %v", err)
+				}
+				if err = os.WriteFile(getProtocDistManifestPath(protocDistPath), manifestBytes, 0644); err != nil {
+					t.Fatalf("os.WriteFile() error: %v", err)
+				}
+			}
+			generator := &Generator{AllowUnpinned: test.allowUnpinned, ProtocVer: "0.0-test", Logger: internal.FuncLogger(t.Logf)}
+			if test.pinned != "" {
+				generator.ProtocSHA256 = map[string]string{osArch: test.pinned}
+			}
+			err := generator.verifySeededProtocDist(protocDistPath)
+			if test.wantErr == "" && err != nil || test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Errorf("verifySeededProtocDist() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
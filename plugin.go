@@ -0,0 +1,237 @@
+package goprotoc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sky91/go-protoc/internal"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// Plugin is a protoc plugin that is go installed into the cache and run by Generator.Run.
+// A Plugin with the Name of a default plugin (go, go-grpc) replaces it, GoOptions included.
+type Plugin struct {
+	Name        string   // used as --<Name>_out, defaults to the binary name without "protoc-gen-"
+	Pkg         string   // Go main package of the plugin, e.g. github.com/bufbuild/connect-go/cmd/protoc-gen-connect-go
+	Version     string   // module version to install, e.g. v1.16.2; empty to use the version from go.mod
+	OutDir      string   // output dir relative to the module dir, empty for the module dir
+	Opts        []string // plugin options, text/template with {{.ModulePath}} and {{.ModuleDir}}
+	EnableIfPkg string   // only run the plugin if this Go package is resolvable from the module
+	Disabled    bool
+
+	resolveVersion func() (string, error) // used by default plugins when Version is empty
+}
+
+func (thisV Plugin) getBinName() string {
+	binName := path.Base(thisV.Pkg)
+	if regexp.MustCompile(`^v\d+$`).MatchString(binName) {
+		binName = path.Base(path.Dir(thisV.Pkg))
+	}
+	return binName
+}
+
+func (thisV Plugin) getName() string {
+	if thisV.Name != "" {
+		return thisV.Name
+	}
+	return strings.TrimPrefix(thisV.getBinName(), "protoc-gen-")
+}
+
+func (thisP *Generator) getPlugins() []Plugin {
+	plugins := []Plugin{
+		{
+			Name:   "go",
+			Pkg:    pkgNameProtocGenGo,
+			OutDir: thisP.GoOptions.OutDir,
+			Opts:   thisP.GoOptions.goOpts(),
+		},
+		{
+			Name:           "go-grpc",
+			Pkg:            pkgNameProtocGenGoGrpc,
+			OutDir:         thisP.GoOptions.OutDir,
+			Opts:           thisP.GoOptions.grpcOpts(),
+			EnableIfPkg:    pkgNameGrpc,
+			resolveVersion: thisP.resolveProtocGenGoGrpcVer,
+		},
+	}
+	for _, plugin := range thisP.Plugins {
+		if i := indexPlugin(plugins, plugin.getName()); i >= 0 {
+			plugins[i] = plugin
+		} else {
+			plugins = append(plugins, plugin)
+		}
+	}
+	return plugins
+}
+
+func indexPlugin(plugins []Plugin, name string) int {
+	for i, plugin := range plugins {
+		if plugin.getName() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// preparedPlugin is an enabled Plugin installed into the cache, or into a temp dir if it is a devel build.
+type preparedPlugin struct {
+	Plugin
+	path      string
+	temporary bool // path is in a temp dir to remove after the run
+}
+
+func (thisP *Generator) preparePlugins(ctx context.Context) (_ []*preparedPlugin, err error) {
+	if err := thisP.GoOptions.validate(); err != nil {
+		return nil, errors.Wrapf(err, "GoOptions.validate() error")
+	}
+	goExe, err := internal.GoEnv("GOEXE")
+	if err != nil {
+		return nil, errors.Wrapf(err, "GoEnv() error")
+	}
+	var prepared []*preparedPlugin
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, plugin := range prepared {
+			if plugin.temporary {
+				_ = os.RemoveAll(filepath.Dir(plugin.path))
+			}
+		}
+	}()
+	for _, plugin := range thisP.getPlugins() {
+		if filepath.IsAbs(plugin.OutDir) {
+			return nil, fmt.Errorf("plugin [%s] OutDir must be relative to the module dir: [%s]", plugin.getName(), plugin.OutDir)
+		}
+		installDir, ok := thisP.shared.pluginInstallDir(plugin.getName())
+		temporary := false
+		if !ok {
+			if installDir, temporary, err = thisP.preparePlugin(ctx, plugin); err != nil {
+				return nil, errors.Wrapf(err, "preparePlugin() error: plugin=[%s]", plugin.getName())
+			}
+		}
+		if installDir == "" {
+			continue
+		}
+		prepared = append(prepared, &preparedPlugin{Plugin: plugin, path: filepath.Join(installDir, plugin.getBinName()+goExe), temporary: temporary})
+	}
+	return prepared, nil
+}
+
+// newPluginInvocations runs the plugins for the module in moduleDir, writing into outDir.
+func newPluginInvocations(plugins []*preparedPlugin, modulePath, moduleDir, outDir string) ([]*pluginInvocation, error) {
+	optsData := struct {
+		ModulePath string
+		ModuleDir  string
+	}{ModulePath: modulePath, ModuleDir: moduleDir}
+
+	invocations := make([]*pluginInvocation, 0, len(plugins))
+	for _, plugin := range plugins {
+		invocation := &pluginInvocation{
+			name: plugin.getName(),
+			path: plugin.path,
+			out:  filepath.Join(outDir, plugin.OutDir),
+		}
+		for _, opt := range plugin.Opts {
+			tmpl, err := template.New("pluginOpt").Parse(opt)
+			if err != nil {
+				return nil, errors.Wrapf(err, "template.New().Parse() error: plugin=[%s]", plugin.getName())
+			}
+			buf := bytes.Buffer{}
+			if err = tmpl.Execute(&buf, optsData); err != nil {
+				return nil, errors.Wrapf(err, "tmpl.Execute() error: plugin=[%s]", plugin.getName())
+			}
+			invocation.opts = append(invocation.opts, buf.String())
+		}
+		invocations = append(invocations, invocation)
+	}
+	return invocations, nil
+}
+
+// preparePlugin installs the plugin into the cache, returning "" if the plugin is not enabled.
+// A devel build, from a replaced or the main module, is installed into a temp dir instead, reported by temporary.
+func (thisP *Generator) preparePlugin(ctx context.Context, plugin Plugin) (installDir string, temporary bool, err error) {
+	if plugin.Disabled {
+		thisP.Logger.Infof("plugin [%s] disabled", plugin.getName())
+		return "", false, nil
+	}
+	if plugin.EnableIfPkg != "" {
+		enablePkg, cmd, err := internal.GoListPkg(plugin.EnableIfPkg, nil)
+		if err != nil {
+			return "", false, errors.Wrapf(err, "GoListPkg() error: cmd=[%+v]", cmd)
+		}
+		if enablePkg.Error != nil {
+			thisP.Logger.Infof("pkg [%s] not found, will not run plugin [%s], cmd=[%+v]", plugin.EnableIfPkg, plugin.getName(), cmd)
+			return "", false, nil
+		}
+		thisP.Logger.Infof("pkg found: [%s@%s]", plugin.EnableIfPkg, enablePkg.Module.Version)
+	}
+
+	installPkg, version := plugin.Pkg, plugin.Version
+	if version == "" && plugin.resolveVersion != nil {
+		if version, err = plugin.resolveVersion(); err != nil {
+			return "", false, errors.Wrapf(err, "resolveVersion() error")
+		}
+	}
+	var modWithVer string
+	if version == "" {
+		pluginPkg, cmd, err := internal.GoListPkg(plugin.Pkg, nil)
+		if err != nil {
+			return "", false, errors.Wrapf(err, "GoListPkg() error: cmd=[%+v]", cmd)
+		}
+		if pluginPkg.Error != nil {
+			return "", false, fmt.Errorf("GoListPkg() error, add the plugin to go.mod or set Plugin.Version: cmd=[%+v], err=[%+v]", cmd, pluginPkg.Error)
+		}
+		thisP.Logger.Infof("GoListPkg() ok: cmd=[%+v]", cmd)
+		thisP.Logger.Infof("pkg found: [%s@%s]", plugin.Pkg, pluginPkg.Module.Version)
+		version, temporary = pluginPkg.Module.Version, pluginPkg.Module.Version == ""
+		modWithVer = pluginPkg.Module.Path + "@" + pluginPkg.Module.Version
+	} else {
+		installPkg += "@" + version
+		modWithVer = installPkg
+	}
+
+	if temporary {
+		if installDir, err = os.MkdirTemp("", "go-protoc-plugin-"); err != nil {
+			return "", false, errors.Wrapf(err, "os.MkdirTemp() error")
+		}
+		thisP.Logger.Infof("devel build of plugin [%s], not cached: [%s]", plugin.getName(), installDir)
+	} else {
+		installDir = filepath.Join(rootDir, plugin.getBinName(), pluginCacheName(plugin.Pkg, version))
+	}
+	if err = thisP.goInstall(ctx, installPkg, modWithVer, installDir); err != nil {
+		if temporary {
+			_ = os.RemoveAll(installDir)
+		}
+		return "", false, errors.Wrapf(err, "goInstall() error")
+	}
+	return installDir, temporary, nil
+}
+
+// pluginCacheName is the cache dir name of a plugin version, keyed on its package path, which holds the module path.
+// Both are escaped like the module cache does, then flattened into one path element.
+func pluginCacheName(pkg, version string) string {
+	return url.PathEscape(escapeModuleCase(pkg) + "@" + escapeModuleCase(version))
+}
+
+// escapeModuleCase escapes upper case letters as !<lower>, as module.EscapePath and module.EscapeVersion do,
+// so names differing only in case do not collide on case-insensitive file systems.
+func escapeModuleCase(s string) string {
+	buf := strings.Builder{}
+	for _, r := range s {
+		if r == '!' || 'A' <= r && r <= 'Z' {
+			buf.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
@@ -0,0 +1,23 @@
+package goprotoc
+
+import "testing"
+
+func TestPluginCacheName(t *testing.T) {
+	tests := []struct {
+		pkg     string
+		version string
+		want    string
+	}{
+		{pkg: "google.golang.org/protobuf/cmd/protoc-gen-go", version: "v1.34.2", want: "google.golang.org%2Fprotobuf%2Fcmd%2Fprotoc-gen-go@v1.34.2"},
+		{pkg: "github.com/Foo/protoc-gen-x", version: "v1.0.0-RC1", want: "github.com%2F%21foo%2Fprotoc-gen-x@v1.0.0-%21r%21c1"},
+		{pkg: "example.com/x", version: "../../evil", want: "example.com%2Fx@..%2F..%2Fevil"},
+	}
+	for _, test := range tests {
+		if got := pluginCacheName(test.pkg, test.version); got != test.want {
+			t.Errorf("pluginCacheName(%s, %s) = %s, want %s", test.pkg, test.version, got, test.want)
+		}
+	}
+	if pluginCacheName("example.com/a/protoc-gen-x", "v1.0.0") == pluginCacheName("example.com/b/protoc-gen-x", "v1.0.0") {
+		t.Errorf("pluginCacheName() of different packages with the same binary name collide")
+	}
+}
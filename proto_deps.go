@@ -0,0 +1,99 @@
+package goprotoc
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sky91/go-protoc/internal"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"path/filepath"
+	"strings"
+)
+
+// moduleProtoPath is the root of a build list module shipping imported .proto files, used as a proto path.
+type moduleProtoPath struct {
+	dir        string
+	modulePath string
+}
+
+// discoverModuleProtoPaths scans the imports reachable from protoFiles and returns the roots of the build list modules
+// shipping the imported files not found in protoPaths, in the order they are needed.
+// Imports found nowhere are logged with file:line and left to the compiler.
+func (thisP *Generator) discoverModuleProtoPaths(protoPaths, protoFiles []string) ([]moduleProtoPath, error) {
+	var found []moduleProtoPath
+	var mods []*internal.ModulePublic
+	modsListed := false
+	searchPaths := append([]string{}, protoPaths...)
+	visited := map[string]bool{}
+	for _, protoFile := range protoFiles {
+		if name, err := relativeToProtoPath(protoPaths, protoFile); err == nil {
+			visited[name] = true
+		}
+	}
+
+	var unresolved []string
+	pending := append([]string{}, protoFiles...)
+	for len(pending) > 0 {
+		file := pending[0]
+		pending = pending[1:]
+		info, err := parseProtoFileInfo(file)
+		if err != nil {
+			// left to the compiler, which reports it with a position
+			continue
+		}
+		for _, imported := range info.imports {
+			if visited[imported.path] {
+				continue
+			}
+			visited[imported.path] = true
+			if dirs := findProtoFile(searchPaths, imported.path); len(dirs) > 0 {
+				pending = append(pending, filepath.Join(dirs[0], filepath.FromSlash(imported.path)))
+				continue
+			}
+			if _, err = protoregistry.GlobalFiles.FindFileByPath(imported.path); err == nil && thisP.getBackend() == BackendGo {
+				// a standard import the go backend links in
+				continue
+			}
+			if !modsListed {
+				if mods, err = thisP.shared.listBuildListMods(); err != nil {
+					return nil, errors.Wrapf(err, "listBuildListMods() error")
+				}
+				modsListed = true
+			}
+			var shipping []*internal.ModulePublic
+			for _, mod := range mods {
+				if mod.Dir != "" && len(findProtoFile([]string{mod.Dir}, imported.path)) > 0 {
+					shipping = append(shipping, mod)
+				}
+			}
+			if len(shipping) == 0 {
+				unresolved = append(unresolved, fmt.Sprintf("%s:%d: [%s]", info.path, imported.line, imported.path))
+				continue
+			}
+			if len(shipping) > 1 {
+				others := make([]string, 0, len(shipping)-1)
+				for _, mod := range shipping[1:] {
+					others = append(others, mod.Path)
+				}
+				thisP.Logger.Infof("import [%s] shipped by more than one module, using [%s], ignoring: %v", imported.path, shipping[0].Path, others)
+			}
+			mod := shipping[0]
+			thisP.Logger.Infof("add proto_path of module [%s@%s] for import [%s]: [%s]", mod.Path, mod.Version, imported.path, mod.Dir)
+			found = append(found, moduleProtoPath{dir: mod.Dir, modulePath: mod.Path})
+			searchPaths = append(searchPaths, mod.Dir)
+			pending = append(pending, filepath.Join(mod.Dir, filepath.FromSlash(imported.path)))
+		}
+	}
+	if len(unresolved) > 0 {
+		thisP.Logger.Errorf("imports not found in the proto paths or the modules of the build list:\n\t%s", strings.Join(unresolved, "\n\t"))
+	}
+	return found, nil
+}
+
+// listBuildListMods lists the build list, tolerating modules that fail to load.
+func listBuildListMods() ([]*internal.ModulePublic, error) {
+	mods, cmd, err := internal.GoListBuildListMods()
+	if err != nil {
+		return nil, fmt.Errorf("GoListBuildListMods() error: cmd=[%+v], err=[%w]", cmd, err)
+	}
+	return mods, nil
+}
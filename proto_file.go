@@ -0,0 +1,53 @@
+package goprotoc
+
+import (
+	"bytes"
+	"github.com/bufbuild/protocompile/ast"
+	"github.com/bufbuild/protocompile/parser"
+	"github.com/bufbuild/protocompile/reporter"
+	"github.com/pkg/errors"
+	"os"
+	"strings"
+)
+
+// protoFileInfo is the part of a .proto file header go-protoc needs before compiling it.
+type protoFileInfo struct {
+	path          string
+	goPackage     string // import path of option go_package, without the ";name" suffix
+	goPackageLine int    // 0 if there is no option go_package
+	goPackageCol  int
+	imports       []protoImport
+}
+
+type protoImport struct {
+	path string
+	line int
+}
+
+// parseProtoFileInfo parses a .proto file without resolving its imports.
+func parseProtoFileInfo(path string) (*protoFileInfo, error) {
+	fileBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "os.ReadFile() error")
+	}
+	fileNode, err := parser.Parse(path, bytes.NewReader(fileBytes), reporter.NewHandler(nil))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parser.Parse() error")
+	}
+	info := &protoFileInfo{path: path}
+	for _, decl := range fileNode.Decls {
+		switch node := decl.(type) {
+		case *ast.ImportNode:
+			info.imports = append(info.imports, protoImport{path: node.Name.AsString(), line: fileNode.NodeInfo(node).Start().Line})
+		case *ast.OptionNode:
+			if len(node.Name.Parts) != 1 || node.Name.Parts[0].IsExtension() || string(node.Name.Parts[0].Name.AsIdentifier()) != "go_package" {
+				continue
+			}
+			if goPackage, ok := node.Val.Value().(string); ok {
+				info.goPackage, _, _ = strings.Cut(goPackage, ";")
+				info.goPackageLine, info.goPackageCol = fileNode.NodeInfo(node).Start().Line, fileNode.NodeInfo(node).Start().Col
+			}
+		}
+	}
+	return info, nil
+}
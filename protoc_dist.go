@@ -0,0 +1,125 @@
+package goprotoc
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sky91/go-protoc/internal"
+	"os"
+	"path/filepath"
+)
+
+// protocDistManifest is written next to an extracted protoc dist, so an intact extraction can be reused.
+type protocDistManifest struct {
+	ArchiveSHA256 string
+	Files         []protocDistManifestFile
+}
+
+type protocDistManifestFile struct {
+	Name string
+	Size int64
+}
+
+// readProtocDistManifest returns nil if there is no manifest.
+func readProtocDistManifest(manifestPath string) (*protocDistManifest, error) {
+	manifestBytes, err := os.ReadFile(manifestPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "os.ReadFile() error")
+	}
+	manifest := &protocDistManifest{}
+	if err = json.Unmarshal(manifestBytes, manifest); err != nil {
+		return nil, fmt.Errorf("protoc dist manifest is broken: [%s], err=[%w]", manifestPath, err)
+	}
+	return manifest, nil
+}
+
+func (thisP *Generator) isProtocDistIntact(protocDistPath string, archiveSHA256 string) bool {
+	manifest, err := readProtocDistManifest(getProtocDistManifestPath(protocDistPath))
+	if err != nil {
+		thisP.Logger.Errorf("readProtocDistManifest() error: [%+v]", err)
+		return false
+	}
+	if manifest == nil {
+		return false
+	}
+	if manifest.ArchiveSHA256 != archiveSHA256 {
+		thisP.Logger.Infof("protoc dist manifest stale: manifest=[%s], archive=[%s]", manifest.ArchiveSHA256, archiveSHA256)
+		return false
+	}
+	for _, file := range manifest.Files {
+		info, err := os.Stat(filepath.Join(protocDistPath, filepath.FromSlash(file.Name)))
+		if err != nil || info.Size() != file.Size {
+			thisP.Logger.Infof("protoc dist file missing or changed: [%s]", file.Name)
+			return false
+		}
+	}
+	return true
+}
+
+func (thisP *Generator) extractProtocDist(zipReader *zip.Reader, archiveSHA256 string, protocDistPath string) error {
+	tmpDir, err := os.MkdirTemp(filepath.Dir(protocDistPath), filepath.Base(protocDistPath)+".tmp-")
+	if err != nil {
+		return errors.Wrapf(err, "os.MkdirTemp() error")
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	if err = internal.Unzip(zipReader, tmpDir); err != nil {
+		return fmt.Errorf("unzip() error: [%w]", err)
+	}
+
+	manifest := &protocDistManifest{ArchiveSHA256: archiveSHA256}
+	for _, f := range zipReader.File {
+		if !f.FileInfo().IsDir() {
+			manifest.Files = append(manifest.Files, protocDistManifestFile{Name: f.Name, Size: int64(f.UncompressedSize64)})
+		}
+	}
+	manifestBytes, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		return errors.Wrapf(err, "json.MarshalIndent() error")
+	}
+
+	manifestPath := getProtocDistManifestPath(protocDistPath)
+	if err = os.Remove(manifestPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "os.Remove() error")
+	}
+	if err = os.RemoveAll(protocDistPath); err != nil {
+		return errors.Wrapf(err, "os.RemoveAll() error")
+	}
+	if err = os.Rename(tmpDir, protocDistPath); err != nil {
+		if thisP.isProtocDistIntact(protocDistPath, archiveSHA256) {
+			thisP.Logger.Infof("protoc dist extracted by another process: [%s]", protocDistPath)
+			return nil
+		}
+		return errors.Wrapf(err, "os.Rename() error")
+	}
+	if err = writeFileAtomic(manifestPath, manifestBytes); err != nil {
+		return errors.Wrapf(err, "writeFileAtomic() error")
+	}
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return errors.Wrapf(err, "os.CreateTemp() error")
+	}
+	defer func() { _ = os.Remove(tmpFile.Name()) }()
+	if _, err = tmpFile.Write(data); err != nil {
+		_ = tmpFile.Close()
+		return errors.Wrapf(err, "tmpFile.Write() error")
+	}
+	if err = tmpFile.Close(); err != nil {
+		return errors.Wrapf(err, "tmpFile.Close() error")
+	}
+	if err = os.Rename(tmpFile.Name(), path); err != nil {
+		return errors.Wrapf(err, "os.Rename() error")
+	}
+	return nil
+}
+
+func getProtocDistManifestPath(protocDistPath string) string {
+	return protocDistPath + ".manifest.json"
+}
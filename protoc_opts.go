@@ -0,0 +1,220 @@
+package goprotoc
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// customProtocOpts is CustomProtocOpts split into what Run can merge with its own options and what it passes as is.
+type customProtocOpts struct {
+	protoPaths   []string
+	pluginParams map[string][]string
+	outs         []customOut
+	args         []string // passed to protoc as is, so not supported by BackendGo
+}
+
+// customOut is a --<name>_out of CustomProtocOpts, written into the out dir of each invocation like ExtraOutputs.
+type customOut struct {
+	key    string // --<name>_out
+	params string // "<params>:" prefix of the value, if any
+	dir    string // relative to the module dir
+}
+
+// parseCustomProtocOpts splits CustomProtocOpts; relative proto paths and out dirs are relative to pkgDir,
+// out dirs must be inside moduleDir.
+func (thisP *Generator) parseCustomProtocOpts(pkgDir, moduleDir string) (*customProtocOpts, error) {
+	opts := &customProtocOpts{pluginParams: map[string][]string{}}
+	for i := 0; i < len(thisP.CustomProtocOpts); i++ {
+		opt := thisP.CustomProtocOpts[i]
+		protoPath, isProtoPath := "", true
+		switch {
+		case opt == "-I" || opt == "--proto_path":
+			if i+1 == len(thisP.CustomProtocOpts) {
+				return nil, fmt.Errorf("CustomProtocOpts: missing value of [%s]", opt)
+			}
+			i++
+			protoPath = thisP.CustomProtocOpts[i]
+		case strings.HasPrefix(opt, "--proto_path="):
+			protoPath = strings.TrimPrefix(opt, "--proto_path=")
+		case strings.HasPrefix(opt, "-I"):
+			protoPath = strings.TrimPrefix(strings.TrimPrefix(opt, "-I"), "=")
+		default:
+			isProtoPath = false
+		}
+		if isProtoPath {
+			opts.protoPaths = append(opts.protoPaths, absPath(pkgDir, protoPath))
+			continue
+		}
+		if name, param, ok := cutPluginOpt(opt); ok {
+			opts.pluginParams[name] = append(opts.pluginParams[name], param)
+			continue
+		}
+		if strings.HasPrefix(opt, "-o") && !strings.HasPrefix(opt, "--") {
+			opt = "--descriptor_set_out=" + strings.TrimPrefix(strings.TrimPrefix(opt, "-o"), "=")
+		}
+		if key, value, ok := strings.Cut(opt, "="); ok && strings.HasPrefix(key, "--") && strings.HasSuffix(key, "_out") {
+			out, err := newCustomOut(key, value, pkgDir, moduleDir)
+			if err != nil {
+				return nil, err
+			}
+			opts.outs = append(opts.outs, out)
+			continue
+		}
+		opts.args = append(opts.args, opt)
+	}
+	return opts, nil
+}
+
+func newCustomOut(key, value, pkgDir, moduleDir string) (customOut, error) {
+	out := customOut{key: key}
+	dir := value
+	if filepath.VolumeName(value) == "" {
+		if params, paramsDir, ok := strings.Cut(value, ":"); ok {
+			out.params, dir = params+":", paramsDir
+		}
+	}
+	rel, err := filepath.Rel(moduleDir, absPath(pkgDir, filepath.FromSlash(dir)))
+	if err != nil || !filepath.IsLocal(rel) && rel != "." {
+		return customOut{}, fmt.Errorf("CustomProtocOpts: [%s=%s] must write inside the module dir [%s], relative to the package dir", key, value, moduleDir)
+	}
+	out.dir = rel
+	return out, nil
+}
+
+// getExtraProtoPaths returns the proto paths added by CustomProtocOpts and ExtraProtoPaths, relative ones resolved from pkgDir.
+func (thisP *Generator) getExtraProtoPaths(pkgDir string, custom *customProtocOpts) []string {
+	protoPaths := append([]string{}, custom.protoPaths...)
+	for _, protoPath := range thisP.ExtraProtoPaths {
+		protoPaths = append(protoPaths, absPath(pkgDir, protoPath))
+	}
+	return protoPaths
+}
+
+// applyExtraOpts adds PluginParams, ExtraOutputs and the other CustomProtocOpts to invocation,
+// failing on options conflicting with the ones Run emits.
+func (thisP *Generator) applyExtraOpts(invocation *protocInvocation, custom *customProtocOpts) error {
+	emitted := map[string]bool{}
+	for _, plugin := range invocation.plugins {
+		emitted[plugin.name] = true
+	}
+
+	pluginParams := map[string][]string{}
+	for name, params := range custom.pluginParams {
+		pluginParams[name] = append(pluginParams[name], params...)
+	}
+	for name, params := range thisP.PluginParams {
+		pluginParams[name] = append(pluginParams[name], params...)
+	}
+	for _, plugin := range invocation.plugins {
+		for _, param := range pluginParams[plugin.name] {
+			if err := plugin.addParam(param); err != nil {
+				return err
+			}
+		}
+		delete(pluginParams, plugin.name)
+	}
+	customOuts := map[string]bool{}
+	for _, out := range custom.outs {
+		customOuts[out.name()] = true
+	}
+	for _, name := range sortedKeys(pluginParams) {
+		if _, ok := thisP.ExtraOutputs[name]; !ok && !customOuts[name] {
+			return fmt.Errorf("plugin params for a plugin that is not enabled: [%s], params=%v", name, pluginParams[name])
+		}
+	}
+
+	var args []string
+	for _, name := range sortedKeys(thisP.ExtraOutputs) {
+		if emitted[name] {
+			return fmt.Errorf("ExtraOutputs: duplicate --%s_out, the plugin is already run", name)
+		}
+		outDir := thisP.ExtraOutputs[name]
+		if !filepath.IsLocal(filepath.FromSlash(outDir)) && outDir != "" {
+			return fmt.Errorf("ExtraOutputs: out dir of [%s] must be relative to the module dir: [%s]", name, outDir)
+		}
+		emitted[name] = true
+		args = append(args, fmt.Sprintf("--%s_out=%s", name, filepath.Join(invocation.outDir, filepath.FromSlash(outDir))))
+		for _, param := range pluginParams[name] {
+			args = append(args, fmt.Sprintf("--%s_opt=%s", name, param))
+		}
+	}
+	for _, out := range custom.outs {
+		switch {
+		case emitted[out.name()]:
+			return fmt.Errorf("CustomProtocOpts: duplicate [%s], already emitted by Run", out.key)
+		case out.key == "--descriptor_set_out" && invocation.descriptorSet != nil:
+			return fmt.Errorf("CustomProtocOpts: [%s] conflicts with DescriptorSet.Out", out.key)
+		}
+		args = append(args, fmt.Sprintf("%s=%s%s", out.key, out.params, filepath.Join(invocation.outDir, out.dir)))
+	}
+	for _, arg := range custom.args {
+		key, value, _ := strings.Cut(arg, "=")
+		if key == "--plugin" && emitted[strings.TrimPrefix(strings.SplitN(value, "=", 2)[0], "protoc-gen-")] {
+			return fmt.Errorf("CustomProtocOpts: [%s] conflicts with the plugin path set by Run", arg)
+		}
+		args = append(args, arg)
+	}
+	for _, name := range sortedKeys(pluginParams) {
+		if _, ok := thisP.ExtraOutputs[name]; ok {
+			continue
+		}
+		for _, param := range pluginParams[name] {
+			args = append(args, fmt.Sprintf("--%s_opt=%s", name, param))
+		}
+	}
+	if len(args) > 0 && thisP.getBackend() == BackendGo {
+		return fmt.Errorf("protoc options not supported by the go backend, only --proto_path and --<plugin>_opt are: %v", args)
+	}
+	invocation.extraArgs = args
+	return nil
+}
+
+// exclusiveParamKeys are params of protogen based plugins, such as protoc-gen-go, that cannot be set together.
+var exclusiveParamKeys = map[string]bool{"module": true, "paths": true}
+
+// addParam adds a --<name>_opt, failing if Run already sets the same key, or an exclusive one, to another value.
+func (thisP *pluginInvocation) addParam(param string) error {
+	key, _, _ := strings.Cut(param, "=")
+	for _, opt := range thisP.opts {
+		if opt == param {
+			return nil
+		}
+		if optKey, _, _ := strings.Cut(opt, "="); optKey == key || exclusiveParamKeys[optKey] && exclusiveParamKeys[key] {
+			return fmt.Errorf("--%s_opt=%s conflicts with --%s_opt=%s set by Run", thisP.name, param, thisP.name, opt)
+		}
+	}
+	thisP.opts = append(thisP.opts, param)
+	return nil
+}
+
+// name is the plugin name of the --<name>_out.
+func (thisV customOut) name() string {
+	return strings.TrimSuffix(strings.TrimPrefix(thisV.key, "--"), "_out")
+}
+
+// cutPluginOpt splits --<name>_opt=<param>.
+func cutPluginOpt(opt string) (name, param string, ok bool) {
+	key, param, ok := strings.Cut(opt, "=")
+	if !ok || !strings.HasPrefix(key, "--") || !strings.HasSuffix(key, "_opt") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(key, "--"), "_opt"), param, true
+}
+
+func absPath(base, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, path)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
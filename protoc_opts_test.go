@@ -0,0 +1,139 @@
+package goprotoc
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCustomProtocOpts(t *testing.T) {
+	moduleDir := filepath.FromSlash("/work")
+	pkgDir := filepath.Join(moduleDir, "pkg")
+	generator := &Generator{CustomProtocOpts: []string{
+		"-I", "third_party",
+		"-Ivendor",
+		"--proto_path=/abs/protos",
+		"--go_opt=Ma/b.proto=example.com/ab",
+		"--python_out=gen",
+		"--python_opt=pyi_out",
+		"--java_out=lite:../java",
+		"-odescriptors.binpb",
+		"--experimental_allow_proto3_optional",
+	}}
+	opts, err := generator.parseCustomProtocOpts(pkgDir, moduleDir)
+	if err != nil {
+		t.Fatalf("parseCustomProtocOpts() error: %v", err)
+	}
+	wantProtoPaths := []string{filepath.Join(pkgDir, "third_party"), filepath.Join(pkgDir, "vendor"), filepath.FromSlash("/abs/protos")}
+	if !reflect.DeepEqual(opts.protoPaths, wantProtoPaths) {
+		t.Errorf("protoPaths = %v, want %v", opts.protoPaths, wantProtoPaths)
+	}
+	wantParams := map[string][]string{"go": {"Ma/b.proto=example.com/ab"}, "python": {"pyi_out"}}
+	if !reflect.DeepEqual(opts.pluginParams, wantParams) {
+		t.Errorf("pluginParams = %v, want %v", opts.pluginParams, wantParams)
+	}
+	wantOuts := []customOut{
+		{key: "--python_out", dir: filepath.Join("pkg", "gen")},
+		{key: "--java_out", params: "lite:", dir: "java"},
+		{key: "--descriptor_set_out", dir: filepath.Join("pkg", "descriptors.binpb")},
+	}
+	if !reflect.DeepEqual(opts.outs, wantOuts) {
+		t.Errorf("outs = %v, want %v", opts.outs, wantOuts)
+	}
+	wantArgs := []string{"--experimental_allow_proto3_optional"}
+	if !reflect.DeepEqual(opts.args, wantArgs) {
+		t.Errorf("args = %v, want %v", opts.args, wantArgs)
+	}
+
+	generator.CustomProtocOpts = []string{"-I"}
+	if _, err = generator.parseCustomProtocOpts(pkgDir, moduleDir); err == nil {
+		t.Errorf("parseCustomProtocOpts() with a missing -I value: want an error")
+	}
+	for _, out := range []string{"--python_out=../../gen", "--python_out=" + filepath.FromSlash("/tmp/gen")} {
+		generator.CustomProtocOpts = []string{out}
+		if _, err = generator.parseCustomProtocOpts(pkgDir, moduleDir); err == nil {
+			t.Errorf("parseCustomProtocOpts() with [%s] outside the module dir: want an error", out)
+		}
+	}
+}
+
+func TestApplyExtraOpts(t *testing.T) {
+	newInvocation := func() *protocInvocation {
+		return &protocInvocation{outDir: "/out", plugins: []*pluginInvocation{{name: "go", opts: []string{"module=example.com/demo"}}}}
+	}
+	tests := []struct {
+		name       string
+		generator  Generator
+		wantArgs   []string
+		wantGoOpts []string
+		wantErr    string
+	}{
+		{
+			name:       "pass-through output with its params",
+			generator:  Generator{CustomProtocOpts: []string{"--python_out=gen", "--python_opt=pyi_out"}},
+			wantArgs:   []string{"--python_out=" + filepath.Join("/out", "pkg", "gen"), "--python_opt=pyi_out"},
+			wantGoOpts: []string{"module=example.com/demo"},
+		},
+		{
+			name:       "params merged into a Run plugin",
+			generator:  Generator{PluginParams: map[string][]string{"go": {"Ma/b.proto=example.com/ab"}}},
+			wantGoOpts: []string{"module=example.com/demo", "Ma/b.proto=example.com/ab"},
+		},
+		{
+			name:      "extra output",
+			generator: Generator{ExtraOutputs: map[string]string{"python": "gen/python"}, PluginParams: map[string][]string{"python": {"pyi_out"}}},
+			wantArgs:  []string{"--python_out=" + filepath.Join("/out", "gen/python"), "--python_opt=pyi_out"},
+		},
+		{
+			name:      "params of a plugin that is not enabled",
+			generator: Generator{PluginParams: map[string][]string{"python": {"pyi_out"}}},
+			wantErr:   "not enabled",
+		},
+		{
+			name:      "conflicting module",
+			generator: Generator{PluginParams: map[string][]string{"go": {"module=foo"}}},
+			wantErr:   "conflicts",
+		},
+		{
+			name:      "paths with module",
+			generator: Generator{CustomProtocOpts: []string{"--go_opt=paths=source_relative"}},
+			wantErr:   "conflicts",
+		},
+		{
+			name:      "duplicate output",
+			generator: Generator{CustomProtocOpts: []string{"--go_out=gen"}},
+			wantErr:   "duplicate",
+		},
+		{
+			name:      "raw args with the go backend",
+			generator: Generator{Backend: BackendGo, CustomProtocOpts: []string{"--python_out=gen"}},
+			wantErr:   "not supported by the go backend",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			custom, err := test.generator.parseCustomProtocOpts(filepath.FromSlash("/module/pkg"), filepath.FromSlash("/module"))
+			if err != nil {
+				t.Fatalf("parseCustomProtocOpts() error: %v", err)
+			}
+			invocation := newInvocation()
+			err = test.generator.applyExtraOpts(invocation, custom)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("applyExtraOpts() error = %v, want containing [%s]", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyExtraOpts() error: %v", err)
+			}
+			if !reflect.DeepEqual(invocation.extraArgs, test.wantArgs) {
+				t.Errorf("extraArgs = %v, want %v", invocation.extraArgs, test.wantArgs)
+			}
+			if test.wantGoOpts != nil && !reflect.DeepEqual(invocation.plugins[0].opts, test.wantGoOpts) {
+				t.Errorf("go opts = %v, want %v", invocation.plugins[0].opts, test.wantGoOpts)
+			}
+		})
+	}
+}
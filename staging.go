@@ -0,0 +1,65 @@
+package goprotoc
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sky91/go-protoc/internal"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// stagingDirName is the dir under a module Run generates into before moving the outputs into place.
+// It starts with a dot, so the go command ignores it.
+const stagingDirName = ".go-protoc-staging"
+
+// getStagingDir is the staging dir of genPkg in moduleDir; it is stable, so the protoc arguments are too.
+func getStagingDir(moduleDir string, genPkg *internal.PackagePublic) string {
+	return filepath.Join(moduleDir, stagingDirName, regexp.MustCompile(`\W+`).ReplaceAllString(genPkg.ImportPath, "_"))
+}
+
+// createStagingDirs empties the staging dirs of the invocations, creating the out dir of every plugin.
+func createStagingDirs(invocations []*protocInvocation) error {
+	for _, invocation := range invocations {
+		if err := os.RemoveAll(invocation.outDir); err != nil {
+			return errors.Wrapf(err, "os.RemoveAll() error")
+		}
+		if err := os.MkdirAll(invocation.outDir, 0755); err != nil {
+			return errors.Wrapf(err, "os.MkdirAll() error")
+		}
+		for _, plugin := range invocation.plugins {
+			if err := os.MkdirAll(plugin.out, 0755); err != nil {
+				return errors.Wrapf(err, "os.MkdirAll() error")
+			}
+		}
+		if invocation.descriptorSet != nil {
+			if err := os.MkdirAll(filepath.Dir(filepath.Join(invocation.outDir, filepath.FromSlash(invocation.descriptorSet.Out))), 0755); err != nil {
+				return errors.Wrapf(err, "os.MkdirAll() error")
+			}
+		}
+	}
+	return nil
+}
+
+// removeStagingDir removes a staging dir, and the staging root of its module once empty.
+func removeStagingDir(stagingDir string) {
+	_ = os.RemoveAll(stagingDir)
+	_ = os.Remove(filepath.Dir(stagingDir))
+}
+
+// moveStagedFiles moves every file generated into stagingDir to the same path under moduleDir, replacing existing files.
+func moveStagedFiles(stagingDir, moduleDir string) error {
+	files, err := listFilesRel(stagingDir, stagingDir)
+	if err != nil {
+		return errors.Wrapf(err, "listFilesRel() error")
+	}
+	for _, file := range files {
+		target := filepath.Join(moduleDir, filepath.FromSlash(file))
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return errors.Wrapf(err, "os.MkdirAll() error")
+		}
+		if err = os.Rename(filepath.Join(stagingDir, filepath.FromSlash(file)), target); err != nil {
+			return errors.Wrapf(err, "os.Rename() error")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package goprotoc
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sky91/go-protoc/internal"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolvePackages finds the package to generate for: TargetDir or TargetPackage, falling back to GOFILE and GOPACKAGE set by go generate.
+// genFilePkg is the generate file listed with the generate build tag so its imports add proto paths; genPkg is the package in the same dir.
+func (thisP *Generator) resolvePackages() (genFilePkg, genPkg *internal.PackagePublic, err error) {
+	target, err := thisP.getTarget()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "getTarget() error")
+	}
+	if genFilePkg, genPkg, err = thisP.resolveTarget(target); err != nil {
+		return nil, nil, errors.Wrapf(err, "resolveTarget() error")
+	}
+	if goPackage := os.Getenv("GOPACKAGE"); target == "." && thisP.TargetPackage == "" &&
+		goPackage != genPkg.Name && goPackage != genFilePkg.Name {
+		return nil, nil, fmt.Errorf("GOPACKAGE [%s] does not match package [%s] in dir [%s]", goPackage, genPkg.Name, genPkg.Dir)
+	}
+	return genFilePkg, genPkg, nil
+}
+
+// resolveTarget lists a generate file, or a package whose first generate tagged file becomes genFilePkg.
+func (thisP *Generator) resolveTarget(target string) (genFilePkg, genPkg *internal.PackagePublic, err error) {
+	if strings.HasSuffix(target, ".go") {
+		if genFilePkg, err = thisP.goListOnePkg(target, []string{"generate"}); err != nil {
+			return nil, nil, errors.Wrapf(err, "goListOnePkg() error")
+		}
+		if genFilePkg.Error != nil {
+			return nil, nil, fmt.Errorf("goListOnePkg() error: target=[%s], pkg.Error=[%+v]", target, genFilePkg.Error)
+		}
+		target = genFilePkg.Dir
+	}
+	if genPkg, err = thisP.goListOnePkg(target, nil); err != nil {
+		return nil, nil, errors.Wrapf(err, "goListOnePkg() error")
+	}
+	if genFilePkg == nil {
+		genFilePkg = thisP.findGenFilePkg(genPkg)
+	}
+	// a dir with only generate tagged files is not a package without the tag
+	if genPkg.Error != nil && (genFilePkg == nil || genPkg.Dir == "" || genPkg.Module == nil) {
+		return nil, nil, fmt.Errorf("goListOnePkg() error: target=[%s], pkg.Error=[%+v]", target, genPkg.Error)
+	}
+	if genFilePkg == nil {
+		genFilePkg = &internal.PackagePublic{Dir: genPkg.Dir, ImportPath: genPkg.ImportPath, Name: genPkg.Name, Module: genPkg.Module}
+	}
+	return genFilePkg, genPkg, nil
+}
+
+func (thisP *Generator) getTarget() (string, error) {
+	switch {
+	case thisP.TargetDir != "" && thisP.TargetPackage != "":
+		return "", fmt.Errorf("only one of TargetDir and TargetPackage can be set: TargetDir=[%s], TargetPackage=[%s]", thisP.TargetDir, thisP.TargetPackage)
+	case thisP.TargetDir != "":
+		dir, err := filepath.Abs(thisP.TargetDir)
+		if err != nil {
+			return "", fmt.Errorf("filepath.Abs() error: [%w]", err)
+		}
+		return dir, nil
+	case thisP.TargetPackage != "":
+		return thisP.TargetPackage, nil
+	}
+	if goFile := os.Getenv("GOFILE"); goFile != "" {
+		return goFile, nil
+	}
+	if goPackage := os.Getenv("GOPACKAGE"); goPackage != "" {
+		return ".", nil
+	}
+	return "", fmt.Errorf("no target package, set TargetDir or TargetPackage, call RunForPackage, or run from go generate")
+}
+
+// goListOnePkg lists the single package matched by target, pkg.Error is left to the caller.
+func (thisP *Generator) goListOnePkg(target string, tags []string) (*internal.PackagePublic, error) {
+	pkgs, cmd, err := internal.GoListPkgs(target, tags)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GoListPkgs() error: cmd=[%+v]", cmd)
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("target must match exactly one package: target=[%s], matched=[%d], cmd=[%+v]", target, len(pkgs), cmd)
+	}
+	thisP.Logger.Infof("GoListPkgs() ok: cmd=[%+v]", cmd)
+	return pkgs[0], nil
+}
+
+// findGenFilePkg lists the first file of pkg ignored without the generate build tag that loads with it, or returns nil.
+func (thisP *Generator) findGenFilePkg(pkg *internal.PackagePublic) *internal.PackagePublic {
+	for _, ignoredFile := range pkg.IgnoredGoFiles {
+		filePkg, cmd, err := internal.GoListPkg(filepath.Join(pkg.Dir, ignoredFile), []string{"generate"})
+		if err != nil || filePkg.Error != nil {
+			continue
+		}
+		thisP.Logger.Infof("GoListPkg() ok: cmd=[%+v]", cmd)
+		return filePkg
+	}
+	return nil
+}
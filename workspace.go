@@ -0,0 +1,142 @@
+package goprotoc
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sky91/go-protoc/internal"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// listWorkspaceModules lists the modules of the go.work workspace, or returns nil outside a workspace.
+func listWorkspaceModules() ([]*internal.ModulePublic, error) {
+	goWork, err := internal.GoEnv("GOWORK")
+	if err != nil {
+		return nil, errors.Wrapf(err, "GoEnv() error")
+	}
+	if goWork == "" || goWork == "off" {
+		return nil, nil
+	}
+	mods, cmd, err := internal.GoListMainMods()
+	if err != nil {
+		return nil, errors.Wrapf(err, "GoListMainMods() error: cmd=[%+v]", cmd)
+	}
+	sort.Slice(mods, func(i, j int) bool { return mods[i].Path < mods[j].Path })
+	return mods, nil
+}
+
+// appendWorkspaceProtoPaths appends the dir of every workspace module with .proto files, after the existing proto paths
+// so they never change the name protoc gives to a file.
+func appendWorkspaceProtoPaths(protoPaths []string, mods []*internal.ModulePublic) ([]string, error) {
+	for _, mod := range mods {
+		if mod.Dir == "" || containsPath(protoPaths, mod.Dir) {
+			continue
+		}
+		hasProto, err := dirHasProtoFiles(mod.Dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "dirHasProtoFiles() error")
+		}
+		if hasProto {
+			protoPaths = append(protoPaths, mod.Dir)
+		}
+	}
+	return protoPaths, nil
+}
+
+// dirHasProtoFiles reports whether a module dir has .proto files, not looking into nested modules, vendor and testdata.
+func dirHasProtoFiles(moduleDir string) (bool, error) {
+	found := false
+	err := filepath.WalkDir(moduleDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.Wrap(err, "WalkDirFunc error")
+		}
+		if d.IsDir() {
+			if path == moduleDir {
+				return nil
+			}
+			if name := d.Name(); name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".proto") {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found, err
+}
+
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if filepath.Clean(p) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+type protoFileGroup struct {
+	module     *internal.ModulePublic
+	protoFiles []string
+}
+
+// groupProtoFilesByModule routes every proto file to the workspace module owning its go_package.
+// The first group is genModule, which also gets the files no other workspace module owns.
+func groupProtoFilesByModule(protoFiles []string, genModule *internal.ModulePublic, workspaceMods []*internal.ModulePublic) ([]*protoFileGroup, error) {
+	groups := []*protoFileGroup{{module: genModule}}
+	if len(workspaceMods) < 2 {
+		groups[0].protoFiles = protoFiles
+		return groups, nil
+	}
+	groupIndexes := map[string]int{genModule.Path: 0}
+	for _, protoFile := range protoFiles {
+		owner := genModule
+		// a file that does not parse is left to protoc to report
+		if info, err := parseProtoFileInfo(protoFile); err == nil {
+			if mod := findOwnerModule(info.goPackage, workspaceMods); mod != nil {
+				owner = mod
+			}
+		}
+		i, ok := groupIndexes[owner.Path]
+		if !ok {
+			i = len(groups)
+			groupIndexes[owner.Path] = i
+			groups = append(groups, &protoFileGroup{module: owner})
+		}
+		groups[i].protoFiles = append(groups[i].protoFiles, protoFile)
+	}
+	return groups, nil
+}
+
+// findOwnerModule returns the module with the longest path that is a prefix of importPath.
+func findOwnerModule(importPath string, mods []*internal.ModulePublic) *internal.ModulePublic {
+	var owner *internal.ModulePublic
+	for _, mod := range mods {
+		if mod.Dir == "" || importPath != mod.Path && !strings.HasPrefix(importPath, mod.Path+"/") {
+			continue
+		}
+		if owner == nil || len(mod.Path) > len(owner.Path) {
+			owner = mod
+		}
+	}
+	return owner
+}
+
+// relSlashPrefix is dir relative to base as a slash path prefix, "" if they are the same dir.
+func relSlashPrefix(base, dir string) string {
+	rel, err := filepath.Rel(base, dir)
+	if err != nil {
+		return filepath.ToSlash(dir) + "/"
+	}
+	if rel == "." {
+		return ""
+	}
+	return filepath.ToSlash(rel) + "/"
+}